@@ -1,30 +1,116 @@
 package workflow
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-gorp/gorp"
 
+	"github.com/ovh/cds/engine/api/cache"
 	"github.com/ovh/cds/sdk"
 	"github.com/ovh/cds/sdk/log"
 )
 
-// insertWorkflowRun inserts in table "workflow_run""
-func insertWorkflowRun(db gorp.SqlExecutor, w *sdk.WorkflowRun) error {
+// runCache is used to speed up and invalidate the hottest workflow run
+// reads (LoadRunByID, LoadLastRun). It is also the only way PostInsert and
+// PostUpdate - gorp hooks that only receive a gorp.SqlExecutor - can reach a
+// cache.Store to invalidate it. Call SetRunCache once from service startup.
+var runCache cache.Store
+
+// SetRunCache registers the cache.Store backing RunRepo reads built with
+// NewRunRepo, and the one used by the PostInsert/PostUpdate hooks to
+// invalidate stale entries.
+func SetRunCache(store cache.Store) {
+	runCache = store
+}
+
+func cacheKeyRun(id int64) string {
+	return cache.Key("workflow_run", strconv.FormatInt(id, 10))
+}
+
+func cacheKeyLastRun(projectKey, workflowName string) string {
+	return cache.Key("workflow_run", "last", projectKey, workflowName)
+}
+
+// RunRepo wraps a gorp executor and groups together the reads and writes that
+// make up a workflow run's lifecycle (insert, status/tag updates, run
+// numbering, listing). Building every call on top of the same RunRepo lets
+// callers compose several of them inside a single transaction via WithTx,
+// instead of issuing unrelated statements against the database directly.
+type RunRepo struct {
+	db    gorp.SqlExecutor
+	cache cache.Store
+}
+
+// NewRunRepo returns a RunRepo backed by db, caching through runCache. db may
+// be a *gorp.DbMap for a top-level repo, or an existing *gorp.Transaction, so
+// a RunRepo can also be built from inside another transaction.
+func NewRunRepo(db gorp.SqlExecutor) RunRepo {
+	return RunRepo{db: db, cache: runCache}
+}
+
+// invalidateCache drops the cached entries for w, if a cache.Store is set.
+func (r RunRepo) invalidateCache(w *sdk.WorkflowRun) {
+	if r.cache == nil {
+		return
+	}
+	r.cache.Delete(cacheKeyRun(w.ID))
+	r.cache.Delete(cacheKeyLastRun(w.Workflow.ProjectKey, w.Workflow.Name))
+}
+
+// WithTx opens a transaction on dbmap and runs fn with a RunRepo bound to it.
+// The transaction is committed if fn returns nil, and rolled back otherwise,
+// so callers can compose several RunRepo methods atomically, e.g.:
+//
+//	err := WithTx(ctx, dbmap, func(repo RunRepo) error {
+//		if err := repo.Insert(run); err != nil {
+//			return err
+//		}
+//		return repo.UpdateStatus(run.ID, string(sdk.StatusBuilding))
+//	})
+func WithTx(ctx context.Context, dbmap *gorp.DbMap, fn func(RunRepo) error) error {
+	tx, err := dbmap.Begin()
+	if err != nil {
+		return sdk.WrapError(err, "WithTx> Unable to start transaction")
+	}
+
+	if err := fn(NewRunRepo(tx)); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Error("WithTx> Unable to rollback transaction: %v", rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return sdk.WrapError(err, "WithTx> Unable to commit transaction")
+	}
+	return nil
+}
+
+// Insert inserts a workflow run in table "workflow_run"
+func (r RunRepo) Insert(w *sdk.WorkflowRun) error {
 	runDB := Run(*w)
-	if err := db.Insert(&runDB); err != nil {
-		return sdk.WrapError(err, "insertWorkflowRun> Unable to insert run")
+	if err := r.db.Insert(&runDB); err != nil {
+		return sdk.WrapError(err, "RunRepo.Insert> Unable to insert run")
 	}
 	w.ID = runDB.ID
+	r.invalidateCache(w)
 	return nil
 }
 
-// updateWorkflowRun updates in table "workflow_run""
-func updateWorkflowRun(db gorp.SqlExecutor, w *sdk.WorkflowRun) error {
+// insertWorkflowRun inserts in table "workflow_run""
+func insertWorkflowRun(db gorp.SqlExecutor, w *sdk.WorkflowRun) error {
+	return NewRunRepo(db).Insert(w)
+}
+
+// Update updates a workflow run in table "workflow_run"
+func (r RunRepo) Update(w *sdk.WorkflowRun) error {
 	w.LastModified = time.Now()
 
 	for _, info := range w.Infos {
@@ -34,23 +120,82 @@ func updateWorkflowRun(db gorp.SqlExecutor, w *sdk.WorkflowRun) error {
 	}
 
 	runDB := Run(*w)
-	if _, err := db.Update(&runDB); err != nil {
-		return sdk.WrapError(err, "updateWorkflowRun> Unable to update run")
+	if _, err := r.db.Update(&runDB); err != nil {
+		return sdk.WrapError(err, "RunRepo.Update> Unable to update run")
 	}
 	w.ID = runDB.ID
+	r.invalidateCache(w)
+	publishRunEvent(r.cache, RunEvent{
+		RunID:    w.ID,
+		Status:   w.Status,
+		Terminal: sdk.StatusIsTerminated(w.Status),
+	})
 	return nil
 }
 
-//UpdateWorkflowRunStatus update status of a workflow run
-func UpdateWorkflowRunStatus(db gorp.SqlExecutor, ID int64, status string) error {
-	//Update workflow run status
+// updateWorkflowRun updates in table "workflow_run""
+func updateWorkflowRun(db gorp.SqlExecutor, w *sdk.WorkflowRun) error {
+	return NewRunRepo(db).Update(w)
+}
+
+// UpdateStatus updates the status of a workflow run
+func (r RunRepo) UpdateStatus(id int64, status string) error {
+	// Resolve the project key/workflow name before the raw UPDATE below, so
+	// LoadLastRun's cache entry - keyed on those, not on id - can be dropped
+	// too. Unlike Insert/Update, UpdateStatus only carries id/status and
+	// never builds a full sdk.WorkflowRun to hand invalidateCache, so this is
+	// looked up on the side instead.
+	projectKey, workflowName, lookupErr := r.projectKeyAndWorkflowName(id)
+	if lookupErr != nil {
+		log.Error("RunRepo.UpdateStatus> Unable to resolve project/workflow for run %d, LoadLastRun cache may serve a stale status: %v", id, lookupErr)
+	}
+
 	query := "UPDATE workflow_run SET status = $1, last_modified = $2 WHERE id = $3"
-	if _, err := db.Exec(query, status, time.Now(), ID); err != nil {
-		return sdk.WrapError(err, "updateWorkflowRunStatus> Unable to set  workflow_run id %d with status %s", ID, status)
+	if _, err := r.db.Exec(query, status, time.Now(), id); err != nil {
+		return sdk.WrapError(err, "RunRepo.UpdateStatus> Unable to set workflow_run id %d with status %s", id, status)
 	}
+
+	if r.cache != nil {
+		r.cache.Delete(cacheKeyRun(id))
+		if lookupErr == nil {
+			r.cache.Delete(cacheKeyLastRun(projectKey, workflowName))
+		}
+	}
+
+	publishRunEvent(r.cache, RunEvent{
+		RunID:    id,
+		Status:   status,
+		Terminal: sdk.StatusIsTerminated(status),
+	})
 	return nil
 }
 
+// projectKeyAndWorkflowName returns the project key and workflow name of run
+// id, so callers that only have an id (like UpdateStatus) can still key a
+// cache entry the same way LoadLastRun does.
+func (r RunRepo) projectKeyAndWorkflowName(id int64) (string, string, error) {
+	res := struct {
+		ProjectKey   string `db:"projectkey"`
+		WorkflowName string `db:"name"`
+	}{}
+
+	query := `select project.projectkey "projectkey", workflow.name "name"
+	from workflow_run
+	join project on workflow_run.project_id = project.id
+	join workflow on workflow_run.workflow_id = workflow.id
+	where workflow_run.id = $1`
+
+	if err := r.db.SelectOne(&res, query, id); err != nil {
+		return "", "", sdk.WrapError(err, "projectKeyAndWorkflowName> Unable to load run %d", id)
+	}
+	return res.ProjectKey, res.WorkflowName, nil
+}
+
+//UpdateWorkflowRunStatus update status of a workflow run
+func UpdateWorkflowRunStatus(db gorp.SqlExecutor, ID int64, status string) error {
+	return NewRunRepo(db).UpdateStatus(ID, status)
+}
+
 //PostInsert is a db hook on WorkflowRun
 func (r *Run) PostInsert(db gorp.SqlExecutor) error {
 	w, errw := json.Marshal(r.Workflow)
@@ -63,14 +208,18 @@ func (r *Run) PostInsert(db gorp.SqlExecutor) error {
 		return sdk.WrapError(erri, "Run.PostInsert> Unable to marshal infos")
 	}
 
-	if _, err := db.Exec("update workflow_run set workflow = $3, infos = $2 where id = $1", r.ID, i, w); err != nil {
+	if _, err := db.Exec("update workflow_run set workflow = $3, infos = $2, schema_version = $4 where id = $1", r.ID, i, w, currentRunSchemaVersion); err != nil {
 		return sdk.WrapError(err, "Run.PostInsert> Unable to store marshalled infos")
 	}
 
-	if err := updateTags(db, r); err != nil {
+	repo := NewRunRepo(db)
+	if err := repo.UpdateTags(r); err != nil {
 		return sdk.WrapError(err, "Run.PostInsert> Unable to store tags")
 	}
 
+	wr := sdk.WorkflowRun(*r)
+	repo.invalidateCache(&wr)
+
 	return nil
 }
 
@@ -85,15 +234,25 @@ func (r *Run) PostGet(db gorp.SqlExecutor) error {
 	var res = struct {
 		W sql.NullString `db:"workflow"`
 		I sql.NullString `db:"infos"`
+		V sql.NullInt64  `db:"schema_version"`
 	}{}
 
-	if err := db.SelectOne(&res, "select workflow, infos from workflow_run where id = $1", r.ID); err != nil {
+	if err := db.SelectOne(&res, "select workflow, infos, schema_version from workflow_run where id = $1", r.ID); err != nil {
 		return sdk.WrapError(err, "Run.PostGet> Unable to load marshalled workflow")
 	}
 	if res.W.Valid {
 		w := sdk.Workflow{}
 		if err := json.Unmarshal([]byte(res.W.String), &w); err != nil {
-			return sdk.WrapError(err, "Run.PostGet> Unable to unmarshal workflow")
+			var typeErr *json.UnmarshalTypeError
+			if !errors.As(err, &typeErr) {
+				return sdk.WrapError(err, "Run.PostGet> Unable to unmarshal workflow")
+			}
+
+			migrated, errMig := migrateRunWorkflow(db, r.ID, []byte(res.W.String), int(res.V.Int64))
+			if errMig != nil {
+				return sdk.WrapError(errMig, "Run.PostGet> Unable to migrate workflow")
+			}
+			w = *migrated
 		}
 		r.Workflow = w
 	}
@@ -109,29 +268,101 @@ func (r *Run) PostGet(db gorp.SqlExecutor) error {
 	return nil
 }
 
-func updateTags(db gorp.SqlExecutor, r *Run) error {
-	if _, err := db.Exec("delete from workflow_run_tag where workflow_run_id = $1", r.ID); err != nil {
-		return sdk.WrapError(err, "Run.updateTags> Unable to store tags")
+// currentRunSchemaVersion is the schema_version stamped on workflow_run rows
+// by PostInsert. Bump it whenever the JSON shape persisted in
+// workflow_run.workflow changes in a way that requires existing rows to be
+// migrated, and register the corresponding RunMigration.
+const currentRunSchemaVersion = 1
+
+// RunMigration upgrades the raw decoding of a workflow_run.workflow blob
+// written at a given schema version to a shape compatible with the current
+// sdk.Workflow struct. Migrations mutate data in place.
+type RunMigration func(data map[string]interface{}) error
+
+var runMigrations = map[int]RunMigration{}
+
+// RegisterRunMigration registers fn to upgrade workflow_run rows whose stored
+// schema_version is fromVersion. PostGet runs the migration chain only when a
+// row's workflow blob fails to decode into the current sdk.Workflow shape
+// with a type error; rows that decode without one are not migrated. Call it
+// from an init() func so modules can bolt on upgrades without editing this
+// file.
+func RegisterRunMigration(fromVersion int, fn RunMigration) {
+	runMigrations[fromVersion] = fn
+}
+
+// migrateRunWorkflow runs every registered migration between fromVersion and
+// currentRunSchemaVersion on raw, then persists and returns the upgraded
+// workflow so future reads of run runID decode it directly.
+func migrateRunWorkflow(db gorp.SqlExecutor, runID int64, raw []byte, fromVersion int) (*sdk.Workflow, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, sdk.WrapError(err, "migrateRunWorkflow> Unable to unmarshal raw workflow for run %d", runID)
+	}
+
+	for v := fromVersion; v < currentRunSchemaVersion; v++ {
+		fn, ok := runMigrations[v]
+		if !ok {
+			return nil, sdk.WrapError(sdk.ErrUnknownError, "migrateRunWorkflow> No migration registered from schema version %d for run %d", v, runID)
+		}
+		if err := fn(data); err != nil {
+			return nil, sdk.WrapError(err, "migrateRunWorkflow> Migration from version %d failed for run %d", v, runID)
+		}
+	}
+
+	upgraded, err := json.Marshal(data)
+	if err != nil {
+		return nil, sdk.WrapError(err, "migrateRunWorkflow> Unable to marshal upgraded workflow for run %d", runID)
+	}
+
+	w := &sdk.Workflow{}
+	if err := json.Unmarshal(upgraded, w); err != nil {
+		return nil, sdk.WrapError(err, "migrateRunWorkflow> Unable to unmarshal upgraded workflow for run %d", runID)
+	}
+
+	if _, err := db.Exec("update workflow_run set workflow = $2, schema_version = $3 where id = $1", runID, upgraded, currentRunSchemaVersion); err != nil {
+		return nil, sdk.WrapError(err, "migrateRunWorkflow> Unable to persist upgraded workflow for run %d", runID)
+	}
+
+	return w, nil
+}
+
+// UpdateTags replaces the tags attached to a workflow run with run.Tags.
+func (r RunRepo) UpdateTags(run *Run) error {
+	if _, err := r.db.Exec("delete from workflow_run_tag where workflow_run_id = $1", run.ID); err != nil {
+		return sdk.WrapError(err, "RunRepo.UpdateTags> Unable to store tags")
 	}
 
 	tags := []interface{}{}
-	for i := range r.Tags {
-		r.Tags[i].WorkflowRunID = r.ID
-		t := RunTag(r.Tags[i])
+	for i := range run.Tags {
+		run.Tags[i].WorkflowRunID = run.ID
+		t := RunTag(run.Tags[i])
 		tags = append(tags, &t)
 	}
 
 	if len(tags) > 0 {
-		if err := db.Insert(tags...); err != nil {
-			return sdk.WrapError(err, "Run.updateTags> Unable to store tags")
+		if err := r.db.Insert(tags...); err != nil {
+			return sdk.WrapError(err, "RunRepo.UpdateTags> Unable to store tags")
 		}
 	}
 
 	return nil
 }
 
+func updateTags(db gorp.SqlExecutor, r *Run) error {
+	return NewRunRepo(db).UpdateTags(r)
+}
+
 // LoadLastRun returns the last run for a workflow
-func LoadLastRun(db gorp.SqlExecutor, projectkey, workflowname string) (*sdk.WorkflowRun, error) {
+func (r RunRepo) LoadLastRun(projectkey, workflowname string) (*sdk.WorkflowRun, error) {
+	key := cacheKeyLastRun(projectkey, workflowname)
+	if r.cache != nil {
+		wr := &sdk.WorkflowRun{}
+		if r.cache.Get(key, wr) {
+			return wr, nil
+		}
+	}
+
 	query := `select workflow_run.*
 	from workflow_run
 	join project on workflow_run.project_id = project.id
@@ -139,11 +370,24 @@ func LoadLastRun(db gorp.SqlExecutor, projectkey, workflowname string) (*sdk.Wor
 	where project.projectkey = $1
 	and workflow.name = $2
 	order by workflow_run.num desc limit 1`
-	return loadRun(db, query, projectkey, workflowname)
+	wr, err := r.loadRun(query, projectkey, workflowname)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.cache != nil {
+		r.cache.Set(key, wr)
+	}
+	return wr, nil
+}
+
+// LoadLastRun returns the last run for a workflow
+func LoadLastRun(db gorp.SqlExecutor, projectkey, workflowname string) (*sdk.WorkflowRun, error) {
+	return NewRunRepo(db).LoadLastRun(projectkey, workflowname)
 }
 
 // LoadRun returns a specific run
-func LoadRun(db gorp.SqlExecutor, projectkey, workflowname string, number int64) (*sdk.WorkflowRun, error) {
+func (r RunRepo) LoadRun(projectkey, workflowname string, number int64) (*sdk.WorkflowRun, error) {
 	query := `select workflow_run.*
 	from workflow_run
 	join project on workflow_run.project_id = project.id
@@ -151,37 +395,74 @@ func LoadRun(db gorp.SqlExecutor, projectkey, workflowname string, number int64)
 	where project.projectkey = $1
 	and workflow.name = $2
 	and workflow_run.num = $3`
-	return loadRun(db, query, projectkey, workflowname, number)
+	return r.loadRun(query, projectkey, workflowname, number)
+}
+
+// LoadRun returns a specific run
+func LoadRun(db gorp.SqlExecutor, projectkey, workflowname string, number int64) (*sdk.WorkflowRun, error) {
+	return NewRunRepo(db).LoadRun(projectkey, workflowname, number)
 }
 
 // LoadRunByIDAndProjectKey returns a specific run
-func LoadRunByIDAndProjectKey(db gorp.SqlExecutor, projectkey string, id int64) (*sdk.WorkflowRun, error) {
+func (r RunRepo) LoadRunByIDAndProjectKey(projectkey string, id int64) (*sdk.WorkflowRun, error) {
 	query := `select workflow_run.*
 	from workflow_run
 	join project on workflow_run.project_id = project.id
 	where project.projectkey = $1
 	and workflow_run.id = $2`
-	return loadRun(db, query, projectkey, id)
+	return r.loadRun(query, projectkey, id)
+}
+
+// LoadRunByIDAndProjectKey returns a specific run
+func LoadRunByIDAndProjectKey(db gorp.SqlExecutor, projectkey string, id int64) (*sdk.WorkflowRun, error) {
+	return NewRunRepo(db).LoadRunByIDAndProjectKey(projectkey, id)
 }
 
 // LoadRunByID loads run by ID
-func LoadRunByID(db gorp.SqlExecutor, id int64) (*sdk.WorkflowRun, error) {
+func (r RunRepo) LoadRunByID(id int64) (*sdk.WorkflowRun, error) {
+	key := cacheKeyRun(id)
+	if r.cache != nil {
+		wr := &sdk.WorkflowRun{}
+		if r.cache.Get(key, wr) {
+			return wr, nil
+		}
+	}
+
 	query := `select workflow_run.*
 	from workflow_run
 	where workflow_run.id = $1`
-	return loadRun(db, query, id)
+	wr, err := r.loadRun(query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.cache != nil {
+		r.cache.Set(key, wr)
+	}
+	return wr, nil
 }
 
-func loadAndLockRunByID(db gorp.SqlExecutor, id int64) (*sdk.WorkflowRun, error) {
+// LoadRunByID loads run by ID
+func LoadRunByID(db gorp.SqlExecutor, id int64) (*sdk.WorkflowRun, error) {
+	return NewRunRepo(db).LoadRunByID(id)
+}
+
+func (r RunRepo) loadAndLockRunByID(id int64) (*sdk.WorkflowRun, error) {
 	query := `select workflow_run.*
 	from workflow_run
 	where workflow_run.id = $1 for update nowait`
-	return loadRun(db, query, id)
+	return r.loadRun(query, id)
+}
+
+func loadAndLockRunByID(db gorp.SqlExecutor, id int64) (*sdk.WorkflowRun, error) {
+	return NewRunRepo(db).loadAndLockRunByID(id)
 }
 
 //LoadRuns loads all runs
-//It retuns runs, offset, limit count and an error
-func LoadRuns(db gorp.SqlExecutor, projectkey, workflowname string, offset, limit int) ([]sdk.WorkflowRun, int, int, int, error) {
+//It retuns runs, offset, limit count and an error. When includeArchived is
+//true, runs from the workflow_run_archive cold storage table are unioned in,
+//so the result transparently spans both hot and archived history.
+func (r RunRepo) LoadRuns(projectkey, workflowname string, offset, limit int, includeArchived bool) ([]sdk.WorkflowRun, int, int, int, error) {
 	queryCount := `select count(workflow_run.id)
 	from workflow_run
 	join project on workflow_run.project_id = project.id
@@ -189,40 +470,97 @@ func LoadRuns(db gorp.SqlExecutor, projectkey, workflowname string, offset, limi
 	where project.projectkey = $1
 	and workflow.name = $2`
 
-	count, errc := db.SelectInt(queryCount, projectkey, workflowname)
+	count, errc := r.db.SelectInt(queryCount, projectkey, workflowname)
 	if errc != nil {
-		return nil, 0, 0, 0, sdk.WrapError(errc, "LoadRuns> unable to load runs")
+		return nil, 0, 0, 0, sdk.WrapError(errc, "RunRepo.LoadRuns> unable to load runs")
 	}
-	if count == 0 {
-		return nil, 0, 0, 0, nil
+
+	wruns := []sdk.WorkflowRun{}
+	if count > 0 {
+		query := `select workflow_run.*
+		from workflow_run
+		join project on workflow_run.project_id = project.id
+		join workflow on workflow_run.workflow_id = workflow.id
+		where project.projectkey = $1
+		and workflow.name = $2
+		order by workflow_run.start desc
+		limit $3 offset $4`
+
+		runs := []Run{}
+		if _, err := r.db.Select(&runs, query, projectkey, workflowname, limit, offset); err != nil {
+			return nil, 0, 0, 0, sdk.WrapError(err, "RunRepo.LoadRuns> unable to load runs")
+		}
+		for i := range runs {
+			wr := sdk.WorkflowRun(runs[i])
+			if err := loadRunTags(r.db, &wr); err != nil {
+				return nil, 0, 0, 0, sdk.WrapError(err, "RunRepo.LoadRuns> unable to load tags")
+			}
+
+			wruns = append(wruns, wr)
+		}
 	}
 
-	query := `select workflow_run.*
-	from workflow_run
-	join project on workflow_run.project_id = project.id
-	join workflow on workflow_run.workflow_id = workflow.id
-	where project.projectkey = $1
-	and workflow.name = $2
-	order by workflow_run.start desc
-	limit $3 offset $4`
-
-	runs := []Run{}
-	if _, err := db.Select(&runs, query, projectkey, workflowname, limit, offset); err != nil {
-		return nil, 0, 0, 0, sdk.WrapError(errc, "LoadRuns> unable to load runs")
-	}
-	wruns := make([]sdk.WorkflowRun, len(runs))
-	for i := range runs {
-		wr := sdk.WorkflowRun(runs[i])
-		if err := loadRunTags(db, &wr); err != nil {
-			return nil, 0, 0, 0, sdk.WrapError(err, "LoadRuns> unable to load tags")
+	// offset/limit page across both tables as if they were a single list
+	// made of every hot run followed by every archived run, without a real
+	// SQL UNION: once the hot page above is short of limit rows, the
+	// remainder comes from the archive, offset by however far past the hot
+	// count the caller asked to start. ArchiveOldRuns never archives one of
+	// the defaultHotRuns most recent runs of a workflow, but it leaves older
+	// runs hot too when they are not terminated or not yet past retention,
+	// so a hot run can be older than an archived one; the result is then
+	// not strictly ordered by start across the two tables.
+	if includeArchived {
+		archivedCount, err := countArchivedRuns(r.db, projectkey, workflowname)
+		if err != nil {
+			return nil, 0, 0, 0, sdk.WrapError(err, "RunRepo.LoadRuns> unable to count archived runs")
 		}
 
-		wruns[i] = wr
+		if remaining := limit - len(wruns); remaining > 0 {
+			archivedOffset := 0
+			if int64(offset) > count {
+				archivedOffset = offset - int(count)
+			}
+
+			archived, err := loadArchivedRuns(r.db, projectkey, workflowname, archivedOffset, remaining)
+			if err != nil {
+				return nil, 0, 0, 0, sdk.WrapError(err, "RunRepo.LoadRuns> unable to load archived runs")
+			}
+			wruns = append(wruns, archived...)
+		}
+		count += archivedCount
+	}
+
+	if len(wruns) == 0 {
+		return nil, 0, 0, 0, nil
 	}
 
 	return wruns, offset, limit, int(count), nil
 }
 
+// countArchivedRuns returns the total number of archived runs of a workflow,
+// regardless of the page being requested - used by LoadRuns to report an
+// accurate total count when includeArchived is set.
+func countArchivedRuns(db gorp.SqlExecutor, projectkey, workflowname string) (int64, error) {
+	query := `select count(workflow_run_archive.id)
+	from workflow_run_archive
+	join project on workflow_run_archive.project_id = project.id
+	join workflow on workflow_run_archive.workflow_id = workflow.id
+	where project.projectkey = $1
+	and workflow.name = $2`
+
+	n, err := db.SelectInt(query, projectkey, workflowname)
+	if err != nil {
+		return 0, sdk.WrapError(err, "countArchivedRuns> Unable to count archived runs for %s/%s", projectkey, workflowname)
+	}
+	return n, nil
+}
+
+//LoadRuns loads all runs
+//It retuns runs, offset, limit count and an error
+func LoadRuns(db gorp.SqlExecutor, projectkey, workflowname string, offset, limit int, includeArchived bool) ([]sdk.WorkflowRun, int, int, int, error) {
+	return NewRunRepo(db).LoadRuns(projectkey, workflowname, offset, limit, includeArchived)
+}
+
 func loadRunTags(db gorp.SqlExecutor, run *sdk.WorkflowRun) error {
 	dbRunTags := []RunTag{}
 	if _, err := db.Select(&dbRunTags, "SELECT * from workflow_run_tag WHERE workflow_run_id=$1", run.ID); err != nil {
@@ -236,9 +574,9 @@ func loadRunTags(db gorp.SqlExecutor, run *sdk.WorkflowRun) error {
 	return nil
 }
 
-func loadRun(db gorp.SqlExecutor, query string, args ...interface{}) (*sdk.WorkflowRun, error) {
+func (r RunRepo) loadRun(query string, args ...interface{}) (*sdk.WorkflowRun, error) {
 	runDB := &Run{}
-	if err := db.SelectOne(runDB, query, args...); err != nil {
+	if err := r.db.SelectOne(runDB, query, args...); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, sdk.ErrWorkflowNotFound
 		}
@@ -248,14 +586,14 @@ func loadRun(db gorp.SqlExecutor, query string, args ...interface{}) (*sdk.Workf
 
 	q := "select workflow_node_run.* from workflow_node_run where workflow_run_id = $1 ORDER BY workflow_node_run.sub_num DESC"
 	dbNodeRuns := []NodeRun{}
-	if _, err := db.Select(&dbNodeRuns, q, wr.ID); err != nil {
+	if _, err := r.db.Select(&dbNodeRuns, q, wr.ID); err != nil {
 		if err != sql.ErrNoRows {
 			return nil, sdk.WrapError(err, "loadRun> Unable to load workflow nodes run")
 		}
 	}
 
 	for _, n := range dbNodeRuns {
-		if err := n.PostGet(db); err != nil {
+		if err := n.PostGet(r.db); err != nil {
 			return nil, sdk.WrapError(err, "loadRun> Unable to load workflow nodes run; postGet Error")
 		}
 		wnr := sdk.WorkflowNodeRun(n)
@@ -271,7 +609,7 @@ func loadRun(db gorp.SqlExecutor, query string, args ...interface{}) (*sdk.Workf
 		})
 	}
 
-	tags, errT := loadTagsByRunID(db, wr.ID)
+	tags, errT := loadTagsByRunID(r.db, wr.ID)
 	if errT != nil {
 		return nil, sdk.WrapError(errT, "loadRun> Error loading tags for run %d", wr.ID)
 	}
@@ -280,6 +618,10 @@ func loadRun(db gorp.SqlExecutor, query string, args ...interface{}) (*sdk.Workf
 	return &wr, nil
 }
 
+func loadRun(db gorp.SqlExecutor, query string, args ...interface{}) (*sdk.WorkflowRun, error) {
+	return RunRepo{db: db}.loadRun(query, args...)
+}
+
 func loadTagsByRunID(db gorp.SqlExecutor, runID int64) ([]sdk.WorkflowRunTag, error) {
 	tags := []sdk.WorkflowRunTag{}
 	dbTags := []sdk.WorkflowRunTag{}
@@ -293,7 +635,7 @@ func loadTagsByRunID(db gorp.SqlExecutor, runID int64) ([]sdk.WorkflowRunTag, er
 }
 
 // GetTagsAndValue returns a map of tags and all the values available on all runs of a workflow
-func GetTagsAndValue(db gorp.SqlExecutor, key, name string) (map[string][]string, error) {
+func (r RunRepo) GetTagsAndValue(key, name string) (map[string][]string, error) {
 	query := `
 SELECT tags.tag "tag", STRING_AGG(tags.value, ',') "values"
 FROM (
@@ -315,8 +657,8 @@ ORDER BY tags.tag;
 		Values string `db:"values"`
 	}{}
 
-	if _, err := db.Select(&res, query, key, name); err != nil {
-		return nil, sdk.WrapError(err, "GetTagsAndValue> Unable to load tags and values")
+	if _, err := r.db.Select(&res, query, key, name); err != nil {
+		return nil, sdk.WrapError(err, "RunRepo.GetTagsAndValue> Unable to load tags and values")
 	}
 
 	rmap := map[string][]string{}
@@ -327,11 +669,21 @@ ORDER BY tags.tag;
 	return rmap, nil
 }
 
-func nextRunNumber(db gorp.SqlExecutor, w *sdk.Workflow) (int64, error) {
-	i, err := db.SelectInt("select workflow_sequences_nextval($1)", w.ID)
+// GetTagsAndValue returns a map of tags and all the values available on all runs of a workflow
+func GetTagsAndValue(db gorp.SqlExecutor, key, name string) (map[string][]string, error) {
+	return NewRunRepo(db).GetTagsAndValue(key, name)
+}
+
+// NextRunNumber returns the next run number for a workflow
+func (r RunRepo) NextRunNumber(w *sdk.Workflow) (int64, error) {
+	i, err := r.db.SelectInt("select workflow_sequences_nextval($1)", w.ID)
 	if err != nil {
-		return 0, sdk.WrapError(err, "nextRunNumber")
+		return 0, sdk.WrapError(err, "RunRepo.NextRunNumber")
 	}
-	log.Debug("nextRunNumber> %s/%s %d", w.ProjectKey, w.Name, i)
+	log.Debug("NextRunNumber> %s/%s %d", w.ProjectKey, w.Name, i)
 	return int64(i), nil
 }
+
+func nextRunNumber(db gorp.SqlExecutor, w *sdk.Workflow) (int64, error) {
+	return NewRunRepo(db).NextRunNumber(w)
+}
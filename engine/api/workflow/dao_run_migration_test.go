@@ -0,0 +1,54 @@
+package workflow
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrateRunWorkflow_AppliesRegisteredMigration(t *testing.T) {
+	defer delete(runMigrations, 0)
+	RegisterRunMigration(0, func(data map[string]interface{}) error {
+		if name, ok := data["old_name"]; ok {
+			data["name"] = name
+			delete(data, "old_name")
+		}
+		return nil
+	})
+
+	dbmap, conn := newFakeDbMap(t)
+	raw := []byte(`{"old_name":"my-workflow"}`)
+
+	if _, err := migrateRunWorkflow(dbmap, 42, raw, 0); err != nil {
+		t.Fatalf("migrateRunWorkflow returned an error: %v", err)
+	}
+
+	if !strings.Contains(conn.lastExecQuery, "update workflow_run set workflow") {
+		t.Fatalf("migrateRunWorkflow did not persist the upgraded workflow, got query %q", conn.lastExecQuery)
+	}
+	if len(conn.lastExecArgs) != 3 {
+		t.Fatalf("persisted with %d args, want 3 (runID, workflow, schema_version)", len(conn.lastExecArgs))
+	}
+	persisted, ok := conn.lastExecArgs[1].(string)
+	if !ok {
+		persistedBytes, ok := conn.lastExecArgs[1].([]byte)
+		if !ok {
+			t.Fatalf("persisted workflow arg has unexpected type %T", conn.lastExecArgs[1])
+		}
+		persisted = string(persistedBytes)
+	}
+	if strings.Contains(persisted, "old_name") || !strings.Contains(persisted, `"name":"my-workflow"`) {
+		t.Fatalf("persisted workflow %q still carries the pre-migration shape", persisted)
+	}
+}
+
+func TestMigrateRunWorkflow_MissingMigrationErrors(t *testing.T) {
+	dbmap, conn := newFakeDbMap(t)
+	raw := []byte(`{"old_name":"my-workflow"}`)
+
+	if _, err := migrateRunWorkflow(dbmap, 42, raw, 0); err == nil {
+		t.Fatalf("migrateRunWorkflow did not error with no migration registered from version 0")
+	}
+	if conn.lastExecQuery != "" {
+		t.Fatalf("migrateRunWorkflow persisted a workflow despite failing to migrate it")
+	}
+}
@@ -0,0 +1,124 @@
+package workflow
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/go-gorp/gorp"
+)
+
+// fakeTx is a driver.Tx that just records whether it was committed or
+// rolled back, so TestWithTx can assert on it without a real database.
+type fakeTx struct {
+	mu                    sync.Mutex
+	committed, rolledBack bool
+}
+
+func (t *fakeTx) Commit() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.committed = true
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rolledBack = true
+	return nil
+}
+
+// fakeConn is a driver.Conn that supports opening transactions and recording
+// the last statement run via Exec, covering what WithTx and
+// migrateRunWorkflow's persistence step need without a real database.
+type fakeConn struct {
+	lastTx        *fakeTx
+	lastExecQuery string
+	lastExecArgs  []driver.Value
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not implemented")
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.lastTx = &fakeTx{}
+	return c.lastTx, nil
+}
+
+// Exec implements the (deprecated but still honored) driver.Execer interface,
+// so database/sql can run an Exec without going through Prepare, which this
+// fake otherwise refuses.
+func (c *fakeConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	c.lastExecQuery = query
+	c.lastExecArgs = args
+	return driver.RowsAffected(1), nil
+}
+
+type fakeDriver struct {
+	conn *fakeConn
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return d.conn, nil
+}
+
+var fakeDriverSeq int64
+
+// newFakeDbMap registers a fresh fakeDriver under a unique name - sql.Register
+// panics on a reused one - so each test gets its own fakeConn to assert on.
+func newFakeDbMap(t *testing.T) (*gorp.DbMap, *fakeConn) {
+	t.Helper()
+
+	conn := &fakeConn{}
+	fakeDriverSeq++
+	name := fmt.Sprintf("withtx-fake-%d", fakeDriverSeq)
+	sql.Register(name, &fakeDriver{conn: conn})
+
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+
+	return &gorp.DbMap{Db: db, Dialect: gorp.PostgresDialect{}}, conn
+}
+
+func TestWithTx_CommitsOnSuccess(t *testing.T) {
+	dbmap, conn := newFakeDbMap(t)
+
+	err := WithTx(context.Background(), dbmap, func(repo RunRepo) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTx returned an error: %v", err)
+	}
+	if conn.lastTx == nil || !conn.lastTx.committed {
+		t.Fatalf("transaction was not committed")
+	}
+	if conn.lastTx.rolledBack {
+		t.Fatalf("transaction was rolled back on success")
+	}
+}
+
+func TestWithTx_RollsBackOnError(t *testing.T) {
+	dbmap, conn := newFakeDbMap(t)
+
+	boom := errors.New("boom")
+	err := WithTx(context.Background(), dbmap, func(repo RunRepo) error {
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("WithTx returned %v, want %v", err, boom)
+	}
+	if conn.lastTx == nil || !conn.lastTx.rolledBack {
+		t.Fatalf("transaction was not rolled back on error")
+	}
+	if conn.lastTx.committed {
+		t.Fatalf("transaction was committed despite fn returning an error")
+	}
+}
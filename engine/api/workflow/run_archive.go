@@ -0,0 +1,261 @@
+package workflow
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"time"
+
+	"github.com/go-gorp/gorp"
+
+	"github.com/ovh/cds/sdk"
+)
+
+// defaultHotRuns is the number of most recent runs of a workflow that are
+// always kept in workflow_run regardless of their age, so LoadLastRun and
+// the UI's run list stay fast without consulting the archive table.
+const defaultHotRuns = 50
+
+// ArchivedRun is the gorp mapping for table workflow_run_archive. Unlike Run,
+// it has no separate workflow and infos JSONB columns: besides the columns
+// needed to list a run, the whole archived sdk.WorkflowRun (its workflow
+// definition and node runs included) is kept as one gzip-compressed JSON
+// blob, so the table stays compact as history grows.
+type ArchivedRun struct {
+	ID           int64     `db:"id"`
+	ProjectID    int64     `db:"project_id"`
+	WorkflowID   int64     `db:"workflow_id"`
+	Num          int64     `db:"num"`
+	Status       string    `db:"status"`
+	Start        time.Time `db:"start"`
+	LastModified time.Time `db:"last_modified"`
+	Tags         string    `db:"tags"` // json-encoded []sdk.WorkflowRunTag
+	Data         []byte    `db:"data"` // gzip-compressed JSON of the archived sdk.WorkflowRun
+}
+
+// WorkflowRetention is the gorp mapping for table workflow_run_retention. A
+// row with WorkflowID set overrides the archive retention for that workflow
+// alone; a row with WorkflowID unset (null) applies to every workflow of
+// ProjectID that has no override of its own. ArchiveOldRuns falls back to
+// its defaultRetention argument when neither exists. Set overrides with
+// SetWorkflowRetention / SetProjectRetention.
+type WorkflowRetention struct {
+	ID            int64         `db:"id"`
+	ProjectID     int64         `db:"project_id"`
+	WorkflowID    sql.NullInt64 `db:"workflow_id"`
+	RetentionDays int           `db:"retention_days"`
+}
+
+// SetWorkflowRetention sets the archive retention override for workflowID,
+// replacing any previous one.
+func SetWorkflowRetention(db gorp.SqlExecutor, projectID, workflowID int64, retentionDays int) error {
+	if _, err := db.Exec("DELETE FROM workflow_run_retention WHERE workflow_id = $1", workflowID); err != nil {
+		return sdk.WrapError(err, "SetWorkflowRetention> Unable to clear previous override for workflow %d", workflowID)
+	}
+	wr := WorkflowRetention{
+		ProjectID:     projectID,
+		WorkflowID:    sql.NullInt64{Int64: workflowID, Valid: true},
+		RetentionDays: retentionDays,
+	}
+	if err := db.Insert(&wr); err != nil {
+		return sdk.WrapError(err, "SetWorkflowRetention> Unable to store override for workflow %d", workflowID)
+	}
+	return nil
+}
+
+// SetProjectRetention sets the archive retention override applied to every
+// workflow of projectID that has no override of its own via
+// SetWorkflowRetention, replacing any previous project-wide override.
+func SetProjectRetention(db gorp.SqlExecutor, projectID int64, retentionDays int) error {
+	if _, err := db.Exec("DELETE FROM workflow_run_retention WHERE project_id = $1 AND workflow_id IS NULL", projectID); err != nil {
+		return sdk.WrapError(err, "SetProjectRetention> Unable to clear previous override for project %d", projectID)
+	}
+	wr := WorkflowRetention{ProjectID: projectID, RetentionDays: retentionDays}
+	if err := db.Insert(&wr); err != nil {
+		return sdk.WrapError(err, "SetProjectRetention> Unable to store override for project %d", projectID)
+	}
+	return nil
+}
+
+// ArchiveOldRuns moves every terminated workflow run older than its
+// effective retention into workflow_run_archive, always leaving the
+// defaultHotRuns most recent runs of each workflow in place. A run's
+// effective retention is, in order: its workflow's override
+// (SetWorkflowRetention), its project's override (SetProjectRetention), or
+// defaultRetention. It returns the number of runs archived.
+//
+// Candidate rows are locked with FOR UPDATE SKIP LOCKED so that when
+// RunArchiver runs on more than one API replica at once, each replica works
+// a disjoint set of rows instead of racing to archive the same run twice.
+func ArchiveOldRuns(ctx context.Context, dbmap *gorp.DbMap, now time.Time, defaultRetention time.Duration) (int, error) {
+	var archived int
+	defaultRetentionDays := int(defaultRetention / (24 * time.Hour))
+
+	err := WithTx(ctx, dbmap, func(repo RunRepo) error {
+		query := `
+		SELECT workflow_run.id
+		FROM workflow_run
+		WHERE workflow_run.last_modified < $1 - (
+			COALESCE(
+				(SELECT retention_days FROM workflow_run_retention wrr WHERE wrr.workflow_id = workflow_run.workflow_id),
+				(SELECT retention_days FROM workflow_run_retention wrr WHERE wrr.project_id = workflow_run.project_id AND wrr.workflow_id IS NULL),
+				$2
+			) * interval '1 day'
+		)
+		AND workflow_run.num <= (
+			SELECT max(w2.num) - $3
+			FROM workflow_run w2
+			WHERE w2.workflow_id = workflow_run.workflow_id
+		)
+		ORDER BY workflow_run.last_modified ASC
+		FOR UPDATE OF workflow_run SKIP LOCKED`
+
+		var ids []int64
+		if _, err := repo.db.Select(&ids, query, now, defaultRetentionDays, defaultHotRuns); err != nil {
+			return sdk.WrapError(err, "ArchiveOldRuns> Unable to list runs to archive")
+		}
+
+		for _, id := range ids {
+			wr, err := loadAndLockRunByID(repo.db, id)
+			if err != nil {
+				return sdk.WrapError(err, "ArchiveOldRuns> Unable to load run %d", id)
+			}
+			if !sdk.StatusIsTerminated(wr.Status) {
+				continue
+			}
+			if err := archiveRun(repo.db, wr); err != nil {
+				return sdk.WrapError(err, "ArchiveOldRuns> Unable to archive run %d", wr.ID)
+			}
+			archived++
+		}
+		return nil
+	})
+
+	return archived, err
+}
+
+// archiveRun writes wr to workflow_run_archive then removes it, its tags and
+// its node runs from the hot tables. Both the insert and the deletes run
+// inside the transaction bound to db.
+func archiveRun(db gorp.SqlExecutor, wr *sdk.WorkflowRun) error {
+	data, err := json.Marshal(wr)
+	if err != nil {
+		return sdk.WrapError(err, "archiveRun> Unable to marshal run %d", wr.ID)
+	}
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write(data); err != nil {
+		return sdk.WrapError(err, "archiveRun> Unable to compress run %d", wr.ID)
+	}
+	if err := gz.Close(); err != nil {
+		return sdk.WrapError(err, "archiveRun> Unable to compress run %d", wr.ID)
+	}
+
+	tags, err := json.Marshal(wr.Tags)
+	if err != nil {
+		return sdk.WrapError(err, "archiveRun> Unable to marshal tags for run %d", wr.ID)
+	}
+
+	ar := ArchivedRun{
+		ProjectID:    wr.ProjectID,
+		WorkflowID:   wr.WorkflowID,
+		Num:          wr.Number,
+		Status:       wr.Status,
+		Start:        wr.Start,
+		LastModified: wr.LastModified,
+		Tags:         string(tags),
+		Data:         compressed.Bytes(),
+	}
+	if err := db.Insert(&ar); err != nil {
+		return sdk.WrapError(err, "archiveRun> Unable to insert archived run %d", wr.ID)
+	}
+
+	if _, err := db.Exec("DELETE FROM workflow_node_run WHERE workflow_run_id = $1", wr.ID); err != nil {
+		return sdk.WrapError(err, "archiveRun> Unable to delete node runs for run %d", wr.ID)
+	}
+	if _, err := db.Exec("DELETE FROM workflow_run_tag WHERE workflow_run_id = $1", wr.ID); err != nil {
+		return sdk.WrapError(err, "archiveRun> Unable to delete tags for run %d", wr.ID)
+	}
+	if _, err := db.Exec("DELETE FROM workflow_run WHERE id = $1", wr.ID); err != nil {
+		return sdk.WrapError(err, "archiveRun> Unable to delete run %d", wr.ID)
+	}
+
+	return nil
+}
+
+// LoadArchivedRun loads a run from the cold storage table workflow_run_archive.
+func LoadArchivedRun(db gorp.SqlExecutor, projectKey, workflowName string, num int64) (*sdk.WorkflowRun, error) {
+	query := `
+	SELECT workflow_run_archive.*
+	FROM workflow_run_archive
+	JOIN project ON workflow_run_archive.project_id = project.id
+	JOIN workflow ON workflow_run_archive.workflow_id = workflow.id
+	WHERE project.projectkey = $1
+	AND workflow.name = $2
+	AND workflow_run_archive.num = $3`
+
+	ar := ArchivedRun{}
+	if err := db.SelectOne(&ar, query, projectKey, workflowName, num); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, sdk.ErrWorkflowNotFound
+		}
+		return nil, sdk.WrapError(err, "LoadArchivedRun> Unable to load archived run %s/%s#%d", projectKey, workflowName, num)
+	}
+
+	return inflateArchivedRun(&ar)
+}
+
+// inflateArchivedRun decompresses and unmarshals an ArchivedRun row back into
+// an sdk.WorkflowRun.
+func inflateArchivedRun(ar *ArchivedRun) (*sdk.WorkflowRun, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(ar.Data))
+	if err != nil {
+		return nil, sdk.WrapError(err, "inflateArchivedRun> Unable to open compressed run %d", ar.ID)
+	}
+	defer gz.Close()
+
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		return nil, sdk.WrapError(err, "inflateArchivedRun> Unable to decompress run %d", ar.ID)
+	}
+
+	wr := &sdk.WorkflowRun{}
+	if err := json.Unmarshal(data, wr); err != nil {
+		return nil, sdk.WrapError(err, "inflateArchivedRun> Unable to unmarshal run %d", ar.ID)
+	}
+
+	return wr, nil
+}
+
+// loadArchivedRuns returns one page of the archived runs of a workflow, most
+// recent first.
+func loadArchivedRuns(db gorp.SqlExecutor, projectkey, workflowname string, offset, limit int) ([]sdk.WorkflowRun, error) {
+	query := `
+	SELECT workflow_run_archive.*
+	FROM workflow_run_archive
+	JOIN project ON workflow_run_archive.project_id = project.id
+	JOIN workflow ON workflow_run_archive.workflow_id = workflow.id
+	WHERE project.projectkey = $1
+	AND workflow.name = $2
+	ORDER BY workflow_run_archive.start DESC
+	LIMIT $3 OFFSET $4`
+
+	ars := []ArchivedRun{}
+	if _, err := db.Select(&ars, query, projectkey, workflowname, limit, offset); err != nil {
+		return nil, sdk.WrapError(err, "loadArchivedRuns> Unable to load archived runs for %s/%s", projectkey, workflowname)
+	}
+
+	runs := make([]sdk.WorkflowRun, len(ars))
+	for i := range ars {
+		wr, err := inflateArchivedRun(&ars[i])
+		if err != nil {
+			return nil, err
+		}
+		runs[i] = *wr
+	}
+	return runs, nil
+}
@@ -0,0 +1,54 @@
+package workflow
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"testing"
+
+	"github.com/ovh/cds/sdk"
+)
+
+func TestInflateArchivedRun_RoundTripsArchiveRunsCompressedData(t *testing.T) {
+	want := &sdk.WorkflowRun{
+		ID:         99,
+		ProjectID:  1,
+		WorkflowID: 2,
+		Number:     7,
+		Status:     "Success",
+	}
+
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatalf("gzip write: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+
+	ar := &ArchivedRun{ID: want.ID, Data: compressed.Bytes()}
+
+	got, err := inflateArchivedRun(ar)
+	if err != nil {
+		t.Fatalf("inflateArchivedRun returned an error: %v", err)
+	}
+
+	if got.ID != want.ID || got.ProjectID != want.ProjectID || got.WorkflowID != want.WorkflowID ||
+		got.Number != want.Number || got.Status != want.Status {
+		t.Fatalf("inflateArchivedRun = %+v, want %+v", got, want)
+	}
+}
+
+func TestInflateArchivedRun_InvalidGzipErrors(t *testing.T) {
+	ar := &ArchivedRun{ID: 1, Data: []byte("not gzip data")}
+
+	if _, err := inflateArchivedRun(ar); err == nil {
+		t.Fatalf("inflateArchivedRun did not error on non-gzip data")
+	}
+}
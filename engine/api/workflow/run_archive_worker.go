@@ -0,0 +1,79 @@
+package workflow
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-gorp/gorp"
+
+	"github.com/ovh/cds/sdk/log"
+)
+
+// archivedRunsTotal counts runs archived by this process since it started. It
+// is exposed through ArchivedRunsTotal so the owning service can publish it
+// alongside its other metrics.
+var archivedRunsTotal int64
+
+// ArchivedRunsTotal returns the number of workflow runs archived by this
+// process since it started.
+func ArchivedRunsTotal() int64 {
+	return atomic.LoadInt64(&archivedRunsTotal)
+}
+
+// ArchiveRetention configures how ArchiveOldRuns decides which runs are eligible
+// for archival: a run is archived once it is older than Retention, but the
+// most recent runs of a workflow are never archived regardless of age (see
+// defaultHotRuns). Retention is only the instance-wide default: a project or
+// workflow can lower or raise it via SetProjectRetention /
+// SetWorkflowRetention, which ArchiveOldRuns consults first.
+type ArchiveRetention struct {
+	Tick      time.Duration
+	Retention time.Duration
+}
+
+// DefaultArchiveRetention is used by services that start the archive worker
+// without an explicit configuration.
+var DefaultArchiveRetention = ArchiveRetention{
+	Tick:      1 * time.Hour,
+	Retention: 90 * 24 * time.Hour,
+}
+
+// RunArchiver periodically moves old workflow runs into cold storage. It
+// blocks until ctx is done, so it runs in a goroutine of its own; nothing in
+// this package starts it.
+func RunArchiver(ctx context.Context, dbFunc func() *gorp.DbMap, cfg ArchiveRetention) {
+	tick := cfg.Tick
+	if tick == 0 {
+		tick = DefaultArchiveRetention.Tick
+	}
+	retention := cfg.Retention
+	if retention == 0 {
+		retention = DefaultArchiveRetention.Retention
+	}
+
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			db := dbFunc()
+			if db == nil {
+				continue
+			}
+
+			now := time.Now()
+			n, err := ArchiveOldRuns(ctx, db, now, retention)
+			if err != nil {
+				log.Error("RunArchiver> Unable to archive workflow runs: %v", err)
+				continue
+			}
+
+			atomic.AddInt64(&archivedRunsTotal, int64(n))
+			log.Info("RunArchiver> archived %d workflow run(s) (default retention %s, total since start: %d)", n, retention, ArchivedRunsTotal())
+		}
+	}
+}
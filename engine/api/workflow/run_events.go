@@ -0,0 +1,171 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ovh/cds/engine/api/cache"
+	"github.com/ovh/cds/sdk"
+	"github.com/ovh/cds/sdk/log"
+)
+
+// RunEvent is one incremental delta published whenever a workflow run or one
+// of its node runs changes state. It carries just enough to patch a client's
+// in-memory sdk.WorkflowRun snapshot, so the SSE stream doesn't have to
+// resend the whole run on every update.
+type RunEvent struct {
+	ID        string    `json:"id"` // per-process sequence number, used as the SSE event id
+	RunID     int64     `json:"run_id"`
+	NodeRunID int64     `json:"node_run_id,omitempty"`
+	SubNumber int64     `json:"sub_number,omitempty"`
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Terminal  bool      `json:"terminal"`
+}
+
+func runEventChannel(runID int64) string {
+	return cache.Key("workflow_run", "events", strconv.FormatInt(runID, 10))
+}
+
+// runEventRingSize bounds how many past events RunEventsHandler can replay to
+// a reconnecting client on this process. Older events are only recoverable by
+// reloading the run's current snapshot.
+const runEventRingSize = 100
+
+// runEventRing keeps the last events published for a given run, so a client
+// reconnecting with Last-Event-ID can be caught up without replaying from
+// Redis, which has no history once a message is delivered. A ring is fed
+// from two sources: publishRunEvent when the event originates on this
+// process, and a background subscription on the run's Redis channel (see
+// feedFromStore) so events published by other API replicas land in it too -
+// otherwise a client reconnecting to a different replica than the one that
+// served it before would hit an empty ring and silently miss every event
+// published while it was disconnected.
+type runEventRing struct {
+	mu        sync.Mutex
+	events    []RunEvent
+	subscribe sync.Once
+}
+
+var runEventRings sync.Map // map[int64]*runEventRing
+
+// ringFor returns the replay ring for runID, creating it if needed. The
+// first caller for a given run starts the background feed from store, if
+// store is set, so the ring stays current even while no client is connected
+// to this process for that run.
+func ringFor(store cache.Store, runID int64) *runEventRing {
+	v, _ := runEventRings.LoadOrStore(runID, &runEventRing{})
+	ring := v.(*runEventRing)
+	if store != nil {
+		ring.subscribe.Do(func() { go ring.feedFromStore(store, runID) })
+	}
+	return ring
+}
+
+func (ring *runEventRing) push(e RunEvent) {
+	ring.mu.Lock()
+	if n := len(ring.events); n > 0 && ring.events[n-1].ID == e.ID {
+		ring.mu.Unlock()
+		return
+	}
+	ring.events = append(ring.events, e)
+	if len(ring.events) > runEventRingSize {
+		ring.events = ring.events[len(ring.events)-runEventRingSize:]
+	}
+	ring.mu.Unlock()
+
+	// Once a run is terminal it will never receive another event, so the
+	// ring itself (and the feedFromStore goroutine that fed it, which also
+	// returns on a terminal event) are done being useful - drop it instead
+	// of leaking one *runEventRing per run ever streamed for the life of
+	// the process.
+	if e.Terminal {
+		runEventRings.Delete(e.RunID)
+	}
+}
+
+// feedFromStore subscribes to runID's Redis channel and pushes every event
+// it receives into ring, so the ring also holds events published by other
+// API replicas. It returns once the run reaches a terminal status.
+func (ring *runEventRing) feedFromStore(store cache.Store, runID int64) {
+	sub, err := store.Subscribe(runEventChannel(runID))
+	if err != nil {
+		log.Error("runEventRing.feedFromStore> Unable to subscribe to run %d events: %v", runID, err)
+		return
+	}
+	defer store.Unsubscribe(sub)
+
+	ctx := context.Background()
+	for {
+		msg, err := store.GetMessageFromSubscription(ctx, sub)
+		if err != nil {
+			log.Error("runEventRing.feedFromStore> subscription error for run %d: %v", runID, err)
+			return
+		}
+
+		var e RunEvent
+		if err := json.Unmarshal([]byte(msg), &e); err != nil {
+			log.Error("runEventRing.feedFromStore> Unable to unmarshal run event: %v", err)
+			continue
+		}
+
+		ring.push(e)
+		if e.Terminal {
+			return
+		}
+	}
+}
+
+// since returns the events that happened after lastEventID, or every known
+// event if lastEventID is empty or no longer in the ring.
+func (ring *runEventRing) since(lastEventID string) []RunEvent {
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+
+	if lastEventID != "" {
+		for i, e := range ring.events {
+			if e.ID == lastEventID {
+				return append([]RunEvent{}, ring.events[i+1:]...)
+			}
+		}
+	}
+	return append([]RunEvent{}, ring.events...)
+}
+
+var runEventSeq int64
+
+// publishRunEvent stamps e with a sequence id, keeps it in this run's replay
+// ring, and fans it out over store's pub/sub so every API replica streaming
+// this run's SSE endpoint receives it. store may be nil, in which case the
+// event is only kept in the local ring.
+func publishRunEvent(store cache.Store, e RunEvent) {
+	e.ID = strconv.FormatInt(atomic.AddInt64(&runEventSeq, 1), 10)
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+
+	ringFor(store, e.RunID).push(e)
+
+	if store == nil {
+		return
+	}
+	store.Publish(runEventChannel(e.RunID), e)
+}
+
+// PublishNodeRunEvent publishes a RunEvent for a node run change. It is the
+// hook node-run updaters call into so their updates reach the same SSE
+// stream as workflow run status changes.
+func PublishNodeRunEvent(store cache.Store, runID int64, n sdk.WorkflowNodeRun) {
+	publishRunEvent(store, RunEvent{
+		RunID:     runID,
+		NodeRunID: n.ID,
+		SubNumber: n.SubNumber,
+		Status:    n.Status,
+		// Terminal is left false: a node run ending does not end the
+		// workflow run, whose own status updates close the stream.
+	})
+}
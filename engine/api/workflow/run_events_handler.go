@@ -0,0 +1,148 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-gorp/gorp"
+	"github.com/gorilla/mux"
+
+	"github.com/ovh/cds/engine/api/cache"
+	"github.com/ovh/cds/sdk"
+	"github.com/ovh/cds/sdk/log"
+)
+
+// RunEventsHandler streams incremental RunEvent patches for one workflow run
+// over Server-Sent Events. It is meant to be wired by the API service at
+// GET /project/{key}/workflows/{name}/runs/{num}/events.
+//
+// It first replays the run's current sdk.WorkflowRun snapshot, then streams
+// the deltas published by RunRepo.Update, RunRepo.UpdateStatus and
+// PublishNodeRunEvent until the run reaches a terminal status, closing the
+// stream with a terminal event so clients know to stop reconnecting. A
+// reconnecting client sending Last-Event-ID is caught up from this run's
+// in-memory replay ring instead of missing events published while it was
+// disconnected.
+func RunEventsHandler(dbFunc func() *gorp.DbMap, store cache.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		projectKey := vars["key"]
+		workflowName := vars["name"]
+		num, err := strconv.ParseInt(vars["num"], 10, 64)
+		if err != nil {
+			http.Error(w, "invalid run number", http.StatusBadRequest)
+			return
+		}
+
+		run, err := LoadRun(dbFunc(), projectKey, workflowName, num)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		if err := writeSSE(w, "snapshot", "", run); err != nil {
+			log.Error("RunEventsHandler> Unable to write snapshot for run %d: %v", run.ID, err)
+			return
+		}
+		flusher.Flush()
+
+		if sdk.StatusIsTerminated(run.Status) {
+			writeSSETerminal(w, run.ID)
+			flusher.Flush()
+			return
+		}
+
+		for _, e := range ringFor(store, run.ID).since(r.Header.Get("Last-Event-ID")) {
+			if err := writeSSE(w, "update", e.ID, e); err != nil {
+				return
+			}
+			if e.Terminal {
+				writeSSETerminal(w, run.ID)
+				flusher.Flush()
+				return
+			}
+		}
+		flusher.Flush()
+
+		if store == nil {
+			// No cache.Store configured: ringFor above already degraded to a
+			// local-only ring, but there is nothing to subscribe to for
+			// events published by other replicas (or, on this replica,
+			// published after the catch-up loop above ran). Close the
+			// stream rather than call Subscribe on a nil store.
+			return
+		}
+
+		sub, err := store.Subscribe(runEventChannel(run.ID))
+		if err != nil {
+			log.Error("RunEventsHandler> Unable to subscribe to run %d events: %v", run.ID, err)
+			return
+		}
+		defer store.Unsubscribe(sub)
+
+		ctx := r.Context()
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+
+			msg, err := store.GetMessageFromSubscription(ctx, sub)
+			if err != nil {
+				log.Error("RunEventsHandler> subscription error for run %d: %v", run.ID, err)
+				return
+			}
+
+			var e RunEvent
+			if err := json.Unmarshal([]byte(msg), &e); err != nil {
+				log.Error("RunEventsHandler> Unable to unmarshal run event: %v", err)
+				continue
+			}
+
+			if err := writeSSE(w, "update", e.ID, e); err != nil {
+				return
+			}
+			flusher.Flush()
+
+			if e.Terminal {
+				writeSSETerminal(w, run.ID)
+				flusher.Flush()
+				return
+			}
+		}
+	}
+}
+
+// writeSSE writes one Server-Sent Events frame. id may be empty, in which
+// case no "id:" line is written.
+func writeSSE(w http.ResponseWriter, event, id string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return sdk.WrapError(err, "writeSSE> Unable to marshal %s event", event)
+	}
+
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
+
+// writeSSETerminal writes the closing event that tells a client the run is
+// done and it should stop reconnecting.
+func writeSSETerminal(w http.ResponseWriter, runID int64) {
+	fmt.Fprintf(w, "event: terminal\ndata: {\"run_id\":%d}\n\n", runID)
+}
@@ -0,0 +1,57 @@
+package workflow
+
+import "testing"
+
+func TestRunEventRing_SinceReplaysOnlyNewEvents(t *testing.T) {
+	ring := &runEventRing{}
+	ring.push(RunEvent{ID: "1", Status: "Building"})
+	ring.push(RunEvent{ID: "2", Status: "Building"})
+	ring.push(RunEvent{ID: "3", Status: "Success", Terminal: true})
+
+	got := ring.since("1")
+	if len(got) != 2 || got[0].ID != "2" || got[1].ID != "3" {
+		t.Fatalf("since(\"1\") = %v, want events 2 and 3", got)
+	}
+
+	all := ring.since("")
+	if len(all) != 3 {
+		t.Fatalf("since(\"\") = %v, want all 3 events", all)
+	}
+
+	unknown := ring.since("not-in-ring")
+	if len(unknown) != 3 {
+		t.Fatalf("since(unknown) = %v, want all 3 events", unknown)
+	}
+}
+
+func TestRunEventRing_PushDropsDuplicatesAndBoundsSize(t *testing.T) {
+	ring := &runEventRing{}
+	ring.push(RunEvent{ID: "1"})
+	ring.push(RunEvent{ID: "1"})
+	if len(ring.events) != 1 {
+		t.Fatalf("push(duplicate) kept %d events, want 1", len(ring.events))
+	}
+
+	for i := 0; i < runEventRingSize+10; i++ {
+		ring.push(RunEvent{ID: string(rune('a' + i%26))})
+	}
+	if len(ring.events) > runEventRingSize {
+		t.Fatalf("ring grew to %d events, want at most %d", len(ring.events), runEventRingSize)
+	}
+}
+
+func TestRunEventRing_PushEvictsRingOnTerminalEvent(t *testing.T) {
+	const runID = int64(42)
+	runEventRings.Delete(runID)
+
+	ring := ringFor(nil, runID)
+	ring.push(RunEvent{ID: "1", RunID: runID, Status: "Building"})
+	if _, ok := runEventRings.Load(runID); !ok {
+		t.Fatalf("ring for run %d was evicted before a terminal event", runID)
+	}
+
+	ring.push(RunEvent{ID: "2", RunID: runID, Status: "Success", Terminal: true})
+	if _, ok := runEventRings.Load(runID); ok {
+		t.Fatalf("ring for run %d was not evicted after a terminal event", runID)
+	}
+}
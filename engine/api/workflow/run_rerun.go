@@ -0,0 +1,181 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-gorp/gorp"
+
+	"github.com/ovh/cds/engine/api/cache"
+	"github.com/ovh/cds/sdk"
+)
+
+// RerunOptions customizes how RerunWorkflowRun derives a new run from an
+// existing one.
+type RerunOptions struct {
+	// Branch and Commit, when set, override the git.branch / git.hash tags
+	// copied from the original run, e.g. to rerun against a newer commit on
+	// the same branch.
+	Branch string
+	Commit string
+	// OnlyFailedNodes seeds the new run with the node runs of NodeIDs (or, if
+	// NodeIDs is empty, of every node that did not succeed on the original
+	// run). When it is false, no node run is seeded and NodeIDs is ignored.
+	OnlyFailedNodes bool
+	NodeIDs []int64
+	// Triggerer identifies who asked for the rerun, recorded in the new
+	// run's WorkflowRunInfo.
+	Triggerer string
+}
+
+// RerunWorkflowRun loads the run identified by id and produces a new
+// sdk.WorkflowRun from it: same tags (unless overridden by opts) and a fresh
+// number from nextRunNumber. With opts.OnlyFailedNodes, the node runs picked
+// by rerunNodeRuns are seeded, payload included, as new, re-runnable
+// workflow_node_run rows on the new run, not just returned in memory, so the
+// scheduler actually has something to pick up and execute. Without it, the
+// new run is inserted with status Waiting and no node run, so no payload of
+// the original run is carried over. The workflow
+// definition is re-resolved from the current workflow table rather than
+// reusing the frozen JSONB stored on the original run, so schema changes made
+// since then propagate to the rerun.
+func RerunWorkflowRun(ctx context.Context, db *gorp.DbMap, store cache.Store, id int64, opts RerunOptions) (*sdk.WorkflowRun, error) {
+	previous, err := LoadRunByID(db, id)
+	if err != nil {
+		return nil, sdk.WrapError(err, "RerunWorkflowRun> Unable to load run %d", id)
+	}
+
+	wf, err := Load(db, store, previous.Workflow.ProjectKey, previous.Workflow.Name, nil, LoadOptions{})
+	if err != nil {
+		return nil, sdk.WrapError(err, "RerunWorkflowRun> Unable to reload workflow %s/%s", previous.Workflow.ProjectKey, previous.Workflow.Name)
+	}
+
+	num, err := nextRunNumber(db, wf)
+	if err != nil {
+		return nil, sdk.WrapError(err, "RerunWorkflowRun> Unable to get next run number")
+	}
+
+	newRun := &sdk.WorkflowRun{
+		ProjectID:    previous.ProjectID,
+		WorkflowID:   wf.ID,
+		Workflow:     *wf,
+		Number:       num,
+		Status:       string(sdk.StatusWaiting),
+		Start:        time.Now(),
+		LastModified: time.Now(),
+		Tags:         rerunTags(previous.Tags, opts),
+	}
+
+	var seeds map[int64][]sdk.WorkflowNodeRun
+	if opts.OnlyFailedNodes {
+		seeds = rerunNodeRuns(previous.WorkflowNodeRuns, opts.NodeIDs)
+	}
+
+	info := sdk.WorkflowRunInfo{
+		APITime: time.Now(),
+		Message: fmt.Sprintf("Workflow run #%d manually triggered from run #%d by %s", num, previous.Number, opts.Triggerer),
+	}
+	newRun.Infos = append(newRun.Infos, info)
+
+	if err := WithTx(ctx, db, func(repo RunRepo) error {
+		if err := repo.Insert(newRun); err != nil {
+			return err
+		}
+		if len(seeds) == 0 {
+			return nil
+		}
+		seeded, err := seedNodeRuns(repo.db, newRun.ID, newRun.Number, seeds)
+		if err != nil {
+			return err
+		}
+		newRun.WorkflowNodeRuns = seeded
+		return nil
+	}); err != nil {
+		return nil, sdk.WrapError(err, "RerunWorkflowRun> Unable to insert rerun of run %d", id)
+	}
+
+	return newRun, nil
+}
+
+// seedNodeRuns inserts one new, re-runnable workflow_node_run row per entry
+// of seeds into the run identified by runID, cloning the seed's pipeline and
+// payload but resetting its status, numbering and timestamps so the
+// scheduler picks it up as a fresh execution rather than a already-completed
+// one. It returns the inserted rows, keyed the same way as seeds.
+func seedNodeRuns(db gorp.SqlExecutor, runID, runNumber int64, seeds map[int64][]sdk.WorkflowNodeRun) (map[int64][]sdk.WorkflowNodeRun, error) {
+	now := time.Now()
+	seeded := make(map[int64][]sdk.WorkflowNodeRun, len(seeds))
+
+	for nodeID, runs := range seeds {
+		if len(runs) == 0 {
+			continue
+		}
+
+		n := runs[0]
+		n.ID = 0
+		n.WorkflowRunID = runID
+		n.WorkflowNodeID = nodeID
+		n.Number = runNumber
+		n.SubNumber = 0
+		n.Status = string(sdk.StatusWaiting)
+		n.Start = now
+		n.LastModified = now
+
+		nodeRunDB := NodeRun(n)
+		if err := db.Insert(&nodeRunDB); err != nil {
+			return nil, sdk.WrapError(err, "seedNodeRuns> Unable to insert rerun seed for node %d", nodeID)
+		}
+
+		seeded[nodeID] = []sdk.WorkflowNodeRun{sdk.WorkflowNodeRun(nodeRunDB)}
+	}
+
+	return seeded, nil
+}
+
+// rerunTags copies the tags of the original run, applying opts' branch/commit
+// overrides on top.
+func rerunTags(previous []sdk.WorkflowRunTag, opts RerunOptions) []sdk.WorkflowRunTag {
+	tags := make([]sdk.WorkflowRunTag, len(previous))
+	copy(tags, previous)
+
+	for i := range tags {
+		switch tags[i].Tag {
+		case "git.branch":
+			if opts.Branch != "" {
+				tags[i].Value = opts.Branch
+			}
+		case "git.hash":
+			if opts.Commit != "" {
+				tags[i].Value = opts.Commit
+			}
+		}
+	}
+
+	return tags
+}
+
+// rerunNodeRuns restricts a previous run's node runs to nodeIDs, or, if
+// nodeIDs is empty, to the nodes that did not end with a success status.
+func rerunNodeRuns(previous map[int64][]sdk.WorkflowNodeRun, nodeIDs []int64) map[int64][]sdk.WorkflowNodeRun {
+	wanted := make(map[int64]bool, len(nodeIDs))
+	for _, id := range nodeIDs {
+		wanted[id] = true
+	}
+
+	kept := make(map[int64][]sdk.WorkflowNodeRun)
+	for nodeID, runs := range previous {
+		if len(nodeIDs) > 0 {
+			if wanted[nodeID] {
+				kept[nodeID] = runs
+			}
+			continue
+		}
+
+		if len(runs) > 0 && runs[0].Status != string(sdk.StatusSuccess) {
+			kept[nodeID] = runs
+		}
+	}
+
+	return kept
+}
@@ -0,0 +1,73 @@
+package workflow
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ovh/cds/sdk"
+)
+
+func TestRerunNodeRuns_ExplicitNodeIDs(t *testing.T) {
+	previous := map[int64][]sdk.WorkflowNodeRun{
+		1: {{ID: 10, Status: string(sdk.StatusSuccess)}},
+		2: {{ID: 20, Status: string(sdk.StatusFail)}},
+		3: {{ID: 30, Status: string(sdk.StatusSuccess)}},
+	}
+
+	kept := rerunNodeRuns(previous, []int64{2})
+
+	want := map[int64][]sdk.WorkflowNodeRun{2: previous[2]}
+	if !reflect.DeepEqual(kept, want) {
+		t.Fatalf("rerunNodeRuns(explicit) = %v, want %v", kept, want)
+	}
+}
+
+func TestRerunNodeRuns_FailedNodesOnly(t *testing.T) {
+	previous := map[int64][]sdk.WorkflowNodeRun{
+		1: {{ID: 10, Status: string(sdk.StatusSuccess)}},
+		2: {{ID: 20, Status: string(sdk.StatusFail)}},
+		3: {{ID: 30, Status: string(sdk.StatusFail)}},
+	}
+
+	kept := rerunNodeRuns(previous, nil)
+
+	want := map[int64][]sdk.WorkflowNodeRun{
+		2: previous[2],
+		3: previous[3],
+	}
+	if !reflect.DeepEqual(kept, want) {
+		t.Fatalf("rerunNodeRuns(failed-only) = %v, want %v", kept, want)
+	}
+}
+
+func TestRerunTags_OverridesBranchAndCommit(t *testing.T) {
+	previous := []sdk.WorkflowRunTag{
+		{Tag: "git.branch", Value: "master"},
+		{Tag: "git.hash", Value: "abcdef"},
+		{Tag: "triggered_by", Value: "cds"},
+	}
+
+	tags := rerunTags(previous, RerunOptions{Branch: "feature/x", Commit: "123456"})
+
+	want := []sdk.WorkflowRunTag{
+		{Tag: "git.branch", Value: "feature/x"},
+		{Tag: "git.hash", Value: "123456"},
+		{Tag: "triggered_by", Value: "cds"},
+	}
+	if !reflect.DeepEqual(tags, want) {
+		t.Fatalf("rerunTags(overrides) = %v, want %v", tags, want)
+	}
+}
+
+func TestRerunTags_NoOverrideKeepsOriginalValues(t *testing.T) {
+	previous := []sdk.WorkflowRunTag{
+		{Tag: "git.branch", Value: "master"},
+		{Tag: "git.hash", Value: "abcdef"},
+	}
+
+	tags := rerunTags(previous, RerunOptions{})
+
+	if !reflect.DeepEqual(tags, previous) {
+		t.Fatalf("rerunTags(no overrides) = %v, want %v", tags, previous)
+	}
+}
@@ -0,0 +1,331 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ovh/cds/engine/api/cache"
+	"github.com/ovh/cds/sdk"
+)
+
+// Client is a sdk.VCSServer backed by a Bitbucket Server (Stash) instance,
+// talking to its REST API.
+type Client struct {
+	url            string
+	clientID       string
+	clientSecret   string
+	sshFingerprint string
+	cache          cache.Store
+	http           *http.Client
+}
+
+// New returns a Bitbucket Server Client for the instance at baseURL.
+// sshFingerprint, if set, is the host key fingerprint expected when cloning
+// over SSH, and is only surfaced through SSHKeyFingerprint - this REST
+// client never opens an SSH connection itself.
+func New(baseURL, clientID, clientSecret, sshFingerprint string, store cache.Store) *Client {
+	return &Client{
+		url:            strings.TrimSuffix(baseURL, "/"),
+		clientID:       clientID,
+		clientSecret:   clientSecret,
+		sshFingerprint: sshFingerprint,
+		cache:          store,
+		http:           &http.Client{},
+	}
+}
+
+// SSHKeyFingerprint returns the host key fingerprint configured for this
+// server, so callers cloning its repositories over SSH can pin against it.
+// It returns "" if none was configured.
+func (c *Client) SSHKeyFingerprint() string {
+	return c.sshFingerprint
+}
+
+// restAPIBasePath is the root of Bitbucket Server's main REST API, used by
+// do for every call except CreateStatus, whose endpoint lives under a
+// different API (see buildStatusBasePath).
+const restAPIBasePath = "/rest/api/1.0"
+
+// buildStatusBasePath is the root of Bitbucket Server's build-status REST
+// API, a sibling of restAPIBasePath rather than a path under it.
+const buildStatusBasePath = "/rest/build-status/1.0"
+
+func (c *Client) do(ctx context.Context, method, path string, out interface{}) error {
+	return c.doBase(ctx, restAPIBasePath, method, path, out)
+}
+
+func (c *Client) doBase(ctx context.Context, basePath, method, path string, out interface{}) error {
+	req, err := http.NewRequest(method, c.url+basePath+path, nil)
+	if err != nil {
+		return sdk.WrapError(err, "bitbucket> Unable to create request")
+	}
+	req = req.WithContext(ctx)
+	req.SetBasicAuth(c.clientID, c.clientSecret)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return sdk.WrapError(err, "bitbucket> Unable to call %s", path)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return sdk.WrapError(sdk.ErrUnknownError, "bitbucket> %s returned HTTP %d", path, resp.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func splitFullname(fullname string) (project, slug string) {
+	parts := strings.SplitN(fullname, "/", 2)
+	if len(parts) != 2 {
+		return fullname, ""
+	}
+	return parts[0], parts[1]
+}
+
+// Repos lists the repositories visible to the configured credentials.
+func (c *Client) Repos(ctx context.Context) ([]sdk.VCSRepo, error) {
+	var page struct {
+		Values []struct {
+			Slug    string `json:"slug"`
+			Project struct {
+				Key string `json:"key"`
+			} `json:"project"`
+			Links struct {
+				Clone []struct {
+					Name string `json:"name"`
+					Href string `json:"href"`
+				} `json:"clone"`
+			} `json:"links"`
+		} `json:"values"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/repos?limit=1000", &page); err != nil {
+		return nil, sdk.WrapError(err, "bitbucket.Repos")
+	}
+
+	repos := make([]sdk.VCSRepo, len(page.Values))
+	for i, r := range page.Values {
+		repo := sdk.VCSRepo{Fullname: fmt.Sprintf("%s/%s", r.Project.Key, r.Slug)}
+		for _, clone := range r.Links.Clone {
+			switch clone.Name {
+			case "ssh":
+				repo.SSHCloneURL = clone.Href
+			case "http":
+				repo.HTTPCloneURL = clone.Href
+			}
+		}
+		repos[i] = repo
+	}
+	return repos, nil
+}
+
+// PullRequests lists the open pull requests of fullname.
+func (c *Client) PullRequests(ctx context.Context, fullname string) ([]sdk.VCSPullRequest, error) {
+	project, slug := splitFullname(fullname)
+	var page struct {
+		Values []struct {
+			ID    int64  `json:"id"`
+			Title string `json:"title"`
+		} `json:"values"`
+	}
+	path := fmt.Sprintf("/projects/%s/repos/%s/pull-requests?state=OPEN", url.PathEscape(project), url.PathEscape(slug))
+	if err := c.do(ctx, http.MethodGet, path, &page); err != nil {
+		return nil, sdk.WrapError(err, "bitbucket.PullRequests> %s", fullname)
+	}
+
+	prs := make([]sdk.VCSPullRequest, len(page.Values))
+	for i, pr := range page.Values {
+		prs[i] = sdk.VCSPullRequest{ID: int(pr.ID), Title: pr.Title}
+	}
+	return prs, nil
+}
+
+// CreateStatus sets a build status on a commit, built from a CDS event.
+func (c *Client) CreateStatus(ctx context.Context, fullname string, event sdk.Event) error {
+	path := fmt.Sprintf("/commits/%s?state=%s&description=%s", event.Hash, url.QueryEscape(event.Status), url.QueryEscape(event.Description))
+	return c.doBase(ctx, buildStatusBasePath, http.MethodPost, path, nil)
+}
+
+// CreateHook registers a Bitbucket Server repository webhook.
+func (c *Client) CreateHook(ctx context.Context, fullname string, hook *sdk.VCSHook) error {
+	project, slug := splitFullname(fullname)
+	path := fmt.Sprintf("/projects/%s/repos/%s/webhooks?url=%s", url.PathEscape(project), url.PathEscape(slug), url.QueryEscape(hook.URL))
+	return c.do(ctx, http.MethodPost, path, nil)
+}
+
+// DeleteHook removes a Bitbucket Server repository webhook.
+func (c *Client) DeleteHook(ctx context.Context, fullname string, hook sdk.VCSHook) error {
+	project, slug := splitFullname(fullname)
+	path := fmt.Sprintf("/projects/%s/repos/%s/webhooks/%s", url.PathEscape(project), url.PathEscape(slug), hook.ID)
+	return c.do(ctx, http.MethodDelete, path, nil)
+}
+
+// GetHook returns a previously registered Bitbucket Server repository webhook.
+func (c *Client) GetHook(ctx context.Context, fullname, id string) (sdk.VCSHook, error) {
+	project, slug := splitFullname(fullname)
+	var h struct {
+		ID  int64  `json:"id"`
+		URL string `json:"url"`
+	}
+	path := fmt.Sprintf("/projects/%s/repos/%s/webhooks/%s", url.PathEscape(project), url.PathEscape(slug), id)
+	if err := c.do(ctx, http.MethodGet, path, &h); err != nil {
+		return sdk.VCSHook{}, sdk.WrapError(err, "bitbucket.GetHook> %s/%s", fullname, id)
+	}
+	return sdk.VCSHook{ID: strconv.FormatInt(h.ID, 10), URL: h.URL}, nil
+}
+
+// UpdateHook updates a Bitbucket Server repository webhook's target URL.
+func (c *Client) UpdateHook(ctx context.Context, fullname string, hook *sdk.VCSHook) error {
+	project, slug := splitFullname(fullname)
+	path := fmt.Sprintf("/projects/%s/repos/%s/webhooks/%s?url=%s", url.PathEscape(project), url.PathEscape(slug), hook.ID, url.QueryEscape(hook.URL))
+	return c.do(ctx, http.MethodPut, path, nil)
+}
+
+// RepoByFullname returns a single repository by its project/slug fullname.
+func (c *Client) RepoByFullname(ctx context.Context, fullname string) (sdk.VCSRepo, error) {
+	project, slug := splitFullname(fullname)
+	var r struct {
+		Slug    string `json:"slug"`
+		Project struct {
+			Key string `json:"key"`
+		} `json:"project"`
+		Links struct {
+			Clone []struct {
+				Name string `json:"name"`
+				Href string `json:"href"`
+			} `json:"clone"`
+		} `json:"links"`
+	}
+	path := fmt.Sprintf("/projects/%s/repos/%s", url.PathEscape(project), url.PathEscape(slug))
+	if err := c.do(ctx, http.MethodGet, path, &r); err != nil {
+		return sdk.VCSRepo{}, sdk.WrapError(err, "bitbucket.RepoByFullname> %s", fullname)
+	}
+
+	repo := sdk.VCSRepo{Fullname: fmt.Sprintf("%s/%s", r.Project.Key, r.Slug)}
+	for _, clone := range r.Links.Clone {
+		switch clone.Name {
+		case "ssh":
+			repo.SSHCloneURL = clone.Href
+		case "http":
+			repo.HTTPCloneURL = clone.Href
+		}
+	}
+	return repo, nil
+}
+
+// Branches lists the branches of fullname.
+func (c *Client) Branches(ctx context.Context, fullname string) ([]sdk.VCSBranch, error) {
+	project, slug := splitFullname(fullname)
+	var page struct {
+		Values []struct {
+			DisplayID    string `json:"displayId"`
+			LatestCommit string `json:"latestCommit"`
+			IsDefault    bool   `json:"isDefault"`
+		} `json:"values"`
+	}
+	path := fmt.Sprintf("/projects/%s/repos/%s/branches?limit=1000", url.PathEscape(project), url.PathEscape(slug))
+	if err := c.do(ctx, http.MethodGet, path, &page); err != nil {
+		return nil, sdk.WrapError(err, "bitbucket.Branches> %s", fullname)
+	}
+
+	res := make([]sdk.VCSBranch, len(page.Values))
+	for i, b := range page.Values {
+		res[i] = sdk.VCSBranch{DisplayID: b.DisplayID, Default: b.IsDefault, LatestCommit: b.LatestCommit}
+	}
+	return res, nil
+}
+
+// Branch returns a single branch of fullname, found by filtering the
+// branches list since Bitbucket Server has no get-by-name endpoint.
+func (c *Client) Branch(ctx context.Context, fullname, branchName string) (*sdk.VCSBranch, error) {
+	branches, err := c.Branches(ctx, fullname)
+	if err != nil {
+		return nil, sdk.WrapError(err, "bitbucket.Branch> %s/%s", fullname, branchName)
+	}
+	for i := range branches {
+		if branches[i].DisplayID == branchName {
+			return &branches[i], nil
+		}
+	}
+	return nil, sdk.WrapError(sdk.ErrNotFound, "bitbucket.Branch> %s/%s", fullname, branchName)
+}
+
+// Commits lists the commits of fullname reachable from branch.
+func (c *Client) Commits(ctx context.Context, fullname, branch, since, until string) ([]sdk.VCSCommit, error) {
+	project, slug := splitFullname(fullname)
+	var page struct {
+		Values []struct {
+			ID      string `json:"id"`
+			Message string `json:"message"`
+			Author  struct {
+				Name string `json:"name"`
+			} `json:"author"`
+		} `json:"values"`
+	}
+	path := fmt.Sprintf("/projects/%s/repos/%s/commits?until=%s", url.PathEscape(project), url.PathEscape(slug), url.QueryEscape(branch))
+	if since != "" {
+		path += "&since=" + url.QueryEscape(since)
+	}
+	if err := c.do(ctx, http.MethodGet, path, &page); err != nil {
+		return nil, sdk.WrapError(err, "bitbucket.Commits> %s", fullname)
+	}
+
+	res := make([]sdk.VCSCommit, len(page.Values))
+	for i, cm := range page.Values {
+		res[i] = sdk.VCSCommit{Hash: cm.ID, Message: cm.Message, Author: sdk.VCSAuthor{Name: cm.Author.Name}}
+	}
+	return res, nil
+}
+
+// Commit returns a single commit of fullname by hash.
+func (c *Client) Commit(ctx context.Context, fullname, hash string) (sdk.VCSCommit, error) {
+	project, slug := splitFullname(fullname)
+	var cm struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+		Author  struct {
+			Name string `json:"name"`
+		} `json:"author"`
+	}
+	path := fmt.Sprintf("/projects/%s/repos/%s/commits/%s", url.PathEscape(project), url.PathEscape(slug), url.PathEscape(hash))
+	if err := c.do(ctx, http.MethodGet, path, &cm); err != nil {
+		return sdk.VCSCommit{}, sdk.WrapError(err, "bitbucket.Commit> %s/%s", fullname, hash)
+	}
+	return sdk.VCSCommit{Hash: cm.ID, Message: cm.Message, Author: sdk.VCSAuthor{Name: cm.Author.Name}}, nil
+}
+
+// Tags lists the tags of fullname.
+func (c *Client) Tags(ctx context.Context, fullname string) ([]sdk.VCSTag, error) {
+	project, slug := splitFullname(fullname)
+	var page struct {
+		Values []struct {
+			DisplayID        string `json:"displayId"`
+			LatestCommit     string `json:"latestCommit"`
+		} `json:"values"`
+	}
+	path := fmt.Sprintf("/projects/%s/repos/%s/tags?limit=1000", url.PathEscape(project), url.PathEscape(slug))
+	if err := c.do(ctx, http.MethodGet, path, &page); err != nil {
+		return nil, sdk.WrapError(err, "bitbucket.Tags> %s", fullname)
+	}
+
+	res := make([]sdk.VCSTag, len(page.Values))
+	for i, t := range page.Values {
+		res[i] = sdk.VCSTag{Tag: t.DisplayID, Hash: t.LatestCommit}
+	}
+	return res, nil
+}
+
+// PullRequestComment posts a comment on a Bitbucket Server pull request.
+func (c *Client) PullRequestComment(ctx context.Context, fullname string, id int, text string) error {
+	project, slug := splitFullname(fullname)
+	path := fmt.Sprintf("/projects/%s/repos/%s/pull-requests/%d/comments?text=%s", url.PathEscape(project), url.PathEscape(slug), id, url.QueryEscape(text))
+	return c.do(ctx, http.MethodPost, path, nil)
+}
@@ -0,0 +1,31 @@
+package bitbucket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ovh/cds/sdk"
+)
+
+func TestCreateStatus_UsesBuildStatusBasePath(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, "id", "secret", "", nil)
+	event := sdk.Event{Hash: "abc123", Status: "SUCCESSFUL", Description: "build ok"}
+
+	if err := c.CreateStatus(context.Background(), "PRJ/repo", event); err != nil {
+		t.Fatalf("CreateStatus returned an error: %v", err)
+	}
+
+	want := "/rest/build-status/1.0/commits/abc123"
+	if gotPath != want {
+		t.Fatalf("CreateStatus called %q, want %q", gotPath, want)
+	}
+}
@@ -0,0 +1,272 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ovh/cds/engine/api/cache"
+	"github.com/ovh/cds/sdk"
+)
+
+// Client is a sdk.VCSServer backed by a Gitea instance, talking to its
+// REST API (v1).
+type Client struct {
+	url            string
+	clientID       string
+	clientSecret   string
+	sshFingerprint string
+	cache          cache.Store
+	http           *http.Client
+}
+
+// New returns a Gitea Client for the instance at baseURL. sshFingerprint, if
+// set, is the host key fingerprint expected when cloning over SSH, and is
+// only surfaced through SSHKeyFingerprint - this REST client never opens an
+// SSH connection itself.
+func New(baseURL, clientID, clientSecret, sshFingerprint string, store cache.Store) *Client {
+	return &Client{
+		url:            strings.TrimSuffix(baseURL, "/"),
+		clientID:       clientID,
+		clientSecret:   clientSecret,
+		sshFingerprint: sshFingerprint,
+		cache:          store,
+		http:           &http.Client{},
+	}
+}
+
+// SSHKeyFingerprint returns the host key fingerprint configured for this
+// server, so callers cloning its repositories over SSH can pin against it.
+// It returns "" if none was configured.
+func (c *Client) SSHKeyFingerprint() string {
+	return c.sshFingerprint
+}
+
+func (c *Client) do(ctx context.Context, method, path string, out interface{}) error {
+	req, err := http.NewRequest(method, c.url+"/api/v1"+path, nil)
+	if err != nil {
+		return sdk.WrapError(err, "gitea> Unable to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "token "+c.clientSecret)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return sdk.WrapError(err, "gitea> Unable to call %s", path)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return sdk.WrapError(sdk.ErrUnknownError, "gitea> %s returned HTTP %d", path, resp.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Repos lists the repositories visible to the configured token.
+func (c *Client) Repos(ctx context.Context) ([]sdk.VCSRepo, error) {
+	var repos []struct {
+		FullName string `json:"full_name"`
+		SSHURL   string `json:"ssh_url"`
+		CloneURL string `json:"clone_url"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/repos/search?limit=50", &repos); err != nil {
+		return nil, sdk.WrapError(err, "gitea.Repos")
+	}
+
+	res := make([]sdk.VCSRepo, len(repos))
+	for i, r := range repos {
+		res[i] = sdk.VCSRepo{
+			Fullname:     r.FullName,
+			SSHCloneURL:  r.SSHURL,
+			HTTPCloneURL: r.CloneURL,
+		}
+	}
+	return res, nil
+}
+
+// PullRequests lists the open pull requests of fullname.
+func (c *Client) PullRequests(ctx context.Context, fullname string) ([]sdk.VCSPullRequest, error) {
+	var prs []struct {
+		Index int64  `json:"number"`
+		Title string `json:"title"`
+	}
+	path := fmt.Sprintf("/repos/%s/pulls?state=open", fullname)
+	if err := c.do(ctx, http.MethodGet, path, &prs); err != nil {
+		return nil, sdk.WrapError(err, "gitea.PullRequests> %s", fullname)
+	}
+
+	res := make([]sdk.VCSPullRequest, len(prs))
+	for i, pr := range prs {
+		res[i] = sdk.VCSPullRequest{ID: int(pr.Index), Title: pr.Title}
+	}
+	return res, nil
+}
+
+// CreateStatus sets a commit status, built from a CDS event.
+func (c *Client) CreateStatus(ctx context.Context, fullname string, event sdk.Event) error {
+	path := fmt.Sprintf("/repos/%s/statuses/%s?state=%s&description=%s", fullname, event.Hash, url.QueryEscape(event.Status), url.QueryEscape(event.Description))
+	return c.do(ctx, http.MethodPost, path, nil)
+}
+
+// CreateHook registers a Gitea repository webhook.
+func (c *Client) CreateHook(ctx context.Context, fullname string, hook *sdk.VCSHook) error {
+	path := fmt.Sprintf("/repos/%s/hooks?type=gitea&config[url]=%s", fullname, url.QueryEscape(hook.URL))
+	return c.do(ctx, http.MethodPost, path, nil)
+}
+
+// DeleteHook removes a Gitea repository webhook.
+func (c *Client) DeleteHook(ctx context.Context, fullname string, hook sdk.VCSHook) error {
+	path := fmt.Sprintf("/repos/%s/hooks/%s", fullname, hook.ID)
+	return c.do(ctx, http.MethodDelete, path, nil)
+}
+
+// GetHook returns a previously registered Gitea repository webhook.
+func (c *Client) GetHook(ctx context.Context, fullname, id string) (sdk.VCSHook, error) {
+	var h struct {
+		ID     int64 `json:"id"`
+		Config struct {
+			URL string `json:"url"`
+		} `json:"config"`
+	}
+	path := fmt.Sprintf("/repos/%s/hooks/%s", fullname, id)
+	if err := c.do(ctx, http.MethodGet, path, &h); err != nil {
+		return sdk.VCSHook{}, sdk.WrapError(err, "gitea.GetHook> %s/%s", fullname, id)
+	}
+	return sdk.VCSHook{ID: strconv.FormatInt(h.ID, 10), URL: h.Config.URL}, nil
+}
+
+// UpdateHook updates a Gitea repository webhook's target URL.
+func (c *Client) UpdateHook(ctx context.Context, fullname string, hook *sdk.VCSHook) error {
+	path := fmt.Sprintf("/repos/%s/hooks/%s?config[url]=%s", fullname, hook.ID, url.QueryEscape(hook.URL))
+	return c.do(ctx, http.MethodPatch, path, nil)
+}
+
+// RepoByFullname returns a single repository by its fullname.
+func (c *Client) RepoByFullname(ctx context.Context, fullname string) (sdk.VCSRepo, error) {
+	var r struct {
+		FullName string `json:"full_name"`
+		SSHURL   string `json:"ssh_url"`
+		CloneURL string `json:"clone_url"`
+	}
+	path := fmt.Sprintf("/repos/%s", fullname)
+	if err := c.do(ctx, http.MethodGet, path, &r); err != nil {
+		return sdk.VCSRepo{}, sdk.WrapError(err, "gitea.RepoByFullname> %s", fullname)
+	}
+	return sdk.VCSRepo{Fullname: r.FullName, SSHCloneURL: r.SSHURL, HTTPCloneURL: r.CloneURL}, nil
+}
+
+// Branches lists the branches of fullname.
+func (c *Client) Branches(ctx context.Context, fullname string) ([]sdk.VCSBranch, error) {
+	var branches []struct {
+		Name   string `json:"name"`
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	path := fmt.Sprintf("/repos/%s/branches", fullname)
+	if err := c.do(ctx, http.MethodGet, path, &branches); err != nil {
+		return nil, sdk.WrapError(err, "gitea.Branches> %s", fullname)
+	}
+
+	repo, err := c.RepoByFullname(ctx, fullname)
+	if err != nil {
+		return nil, sdk.WrapError(err, "gitea.Branches> %s", fullname)
+	}
+
+	res := make([]sdk.VCSBranch, len(branches))
+	for i, b := range branches {
+		res[i] = sdk.VCSBranch{DisplayID: b.Name, LatestCommit: b.Commit.ID, Default: b.Name == repo.DefaultBranch}
+	}
+	return res, nil
+}
+
+// Branch returns a single branch of fullname.
+func (c *Client) Branch(ctx context.Context, fullname, branchName string) (*sdk.VCSBranch, error) {
+	var b struct {
+		Name   string `json:"name"`
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	path := fmt.Sprintf("/repos/%s/branches/%s", fullname, url.PathEscape(branchName))
+	if err := c.do(ctx, http.MethodGet, path, &b); err != nil {
+		return nil, sdk.WrapError(err, "gitea.Branch> %s/%s", fullname, branchName)
+	}
+	return &sdk.VCSBranch{DisplayID: b.Name, LatestCommit: b.Commit.ID}, nil
+}
+
+// Commits lists the commits of fullname on branch.
+func (c *Client) Commits(ctx context.Context, fullname, branch, since, until string) ([]sdk.VCSCommit, error) {
+	var commits []struct {
+		SHA    string `json:"sha"`
+		Commit struct {
+			Message string `json:"message"`
+			Author  struct {
+				Name string `json:"name"`
+			} `json:"author"`
+		} `json:"commit"`
+	}
+	path := fmt.Sprintf("/repos/%s/commits?sha=%s", fullname, url.QueryEscape(branch))
+	if err := c.do(ctx, http.MethodGet, path, &commits); err != nil {
+		return nil, sdk.WrapError(err, "gitea.Commits> %s", fullname)
+	}
+
+	res := make([]sdk.VCSCommit, len(commits))
+	for i, cm := range commits {
+		res[i] = sdk.VCSCommit{Hash: cm.SHA, Message: cm.Commit.Message, Author: sdk.VCSAuthor{Name: cm.Commit.Author.Name}}
+	}
+	return res, nil
+}
+
+// Commit returns a single commit of fullname by sha.
+func (c *Client) Commit(ctx context.Context, fullname, hash string) (sdk.VCSCommit, error) {
+	var cm struct {
+		SHA    string `json:"sha"`
+		Commit struct {
+			Message string `json:"message"`
+			Author  struct {
+				Name string `json:"name"`
+			} `json:"author"`
+		} `json:"commit"`
+	}
+	path := fmt.Sprintf("/repos/%s/git/commits/%s", fullname, url.PathEscape(hash))
+	if err := c.do(ctx, http.MethodGet, path, &cm); err != nil {
+		return sdk.VCSCommit{}, sdk.WrapError(err, "gitea.Commit> %s/%s", fullname, hash)
+	}
+	return sdk.VCSCommit{Hash: cm.SHA, Message: cm.Commit.Message, Author: sdk.VCSAuthor{Name: cm.Commit.Author.Name}}, nil
+}
+
+// Tags lists the tags of fullname.
+func (c *Client) Tags(ctx context.Context, fullname string) ([]sdk.VCSTag, error) {
+	var tags []struct {
+		Name   string `json:"name"`
+		Commit struct {
+			SHA string `json:"sha"`
+		} `json:"commit"`
+	}
+	path := fmt.Sprintf("/repos/%s/tags", fullname)
+	if err := c.do(ctx, http.MethodGet, path, &tags); err != nil {
+		return nil, sdk.WrapError(err, "gitea.Tags> %s", fullname)
+	}
+
+	res := make([]sdk.VCSTag, len(tags))
+	for i, t := range tags {
+		res[i] = sdk.VCSTag{Tag: t.Name, Hash: t.Commit.SHA}
+	}
+	return res, nil
+}
+
+// PullRequestComment posts a comment on a Gitea pull request (Gitea models
+// PR comments as issue comments, since a pull request is also an issue).
+func (c *Client) PullRequestComment(ctx context.Context, fullname string, id int, text string) error {
+	path := fmt.Sprintf("/repos/%s/issues/%d/comments?body=%s", fullname, id, url.QueryEscape(text))
+	return c.do(ctx, http.MethodPost, path, nil)
+}
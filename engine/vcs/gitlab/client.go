@@ -0,0 +1,272 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ovh/cds/engine/api/cache"
+	"github.com/ovh/cds/sdk"
+)
+
+// Client is a sdk.VCSServer backed by a GitLab instance (gitlab.com or a
+// self-hosted one), talking to its REST v4 API.
+type Client struct {
+	url            string
+	clientID       string
+	clientSecret   string
+	sshFingerprint string
+	cache          cache.Store
+	http           *http.Client
+}
+
+// New returns a GitLab Client for the instance at baseURL. sshFingerprint, if
+// set, is the host key fingerprint expected when cloning over SSH, and is
+// only surfaced through SSHKeyFingerprint - this REST client never opens an
+// SSH connection itself.
+func New(baseURL, clientID, clientSecret, sshFingerprint string, store cache.Store) *Client {
+	return &Client{
+		url:            strings.TrimSuffix(baseURL, "/"),
+		clientID:       clientID,
+		clientSecret:   clientSecret,
+		sshFingerprint: sshFingerprint,
+		cache:          store,
+		http:           &http.Client{},
+	}
+}
+
+// SSHKeyFingerprint returns the host key fingerprint configured for this
+// server, so callers cloning its repositories over SSH can pin against it.
+// It returns "" if none was configured.
+func (c *Client) SSHKeyFingerprint() string {
+	return c.sshFingerprint
+}
+
+func (c *Client) do(ctx context.Context, method, path string, out interface{}) error {
+	req, err := http.NewRequest(method, c.url+"/api/v4"+path, nil)
+	if err != nil {
+		return sdk.WrapError(err, "gitlab> Unable to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("PRIVATE-TOKEN", c.clientSecret)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return sdk.WrapError(err, "gitlab> Unable to call %s", path)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return sdk.WrapError(sdk.ErrUnknownError, "gitlab> %s returned HTTP %d", path, resp.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Repos lists the projects visible to the configured token.
+func (c *Client) Repos(ctx context.Context) ([]sdk.VCSRepo, error) {
+	var projects []struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		SSHURLToRepo      string `json:"ssh_url_to_repo"`
+		HTTPURLToRepo     string `json:"http_url_to_repo"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/projects?membership=true&per_page=100", &projects); err != nil {
+		return nil, sdk.WrapError(err, "gitlab.Repos")
+	}
+
+	repos := make([]sdk.VCSRepo, len(projects))
+	for i, p := range projects {
+		repos[i] = sdk.VCSRepo{
+			Fullname: p.PathWithNamespace,
+			SSHCloneURL:  p.SSHURLToRepo,
+			HTTPCloneURL: p.HTTPURLToRepo,
+		}
+	}
+	return repos, nil
+}
+
+// PullRequests lists the open merge requests of fullname.
+func (c *Client) PullRequests(ctx context.Context, fullname string) ([]sdk.VCSPullRequest, error) {
+	var mrs []struct {
+		IID    int64  `json:"iid"`
+		Title  string `json:"title"`
+		State  string `json:"state"`
+	}
+	path := fmt.Sprintf("/projects/%s/merge_requests?state=opened", url.QueryEscape(fullname))
+	if err := c.do(ctx, http.MethodGet, path, &mrs); err != nil {
+		return nil, sdk.WrapError(err, "gitlab.PullRequests> %s", fullname)
+	}
+
+	prs := make([]sdk.VCSPullRequest, len(mrs))
+	for i, mr := range mrs {
+		prs[i] = sdk.VCSPullRequest{
+			ID:    int(mr.IID),
+			Title: mr.Title,
+		}
+	}
+	return prs, nil
+}
+
+// CreateStatus sets a GitLab commit status built from a CDS event.
+func (c *Client) CreateStatus(ctx context.Context, fullname string, event sdk.Event) error {
+	path := fmt.Sprintf("/projects/%s/statuses/%s", url.QueryEscape(fullname), event.Hash)
+	return c.do(ctx, http.MethodPost, path+"?state="+url.QueryEscape(event.Status)+"&description="+url.QueryEscape(event.Description), nil)
+}
+
+// CreateHook registers a GitLab project webhook.
+func (c *Client) CreateHook(ctx context.Context, fullname string, hook *sdk.VCSHook) error {
+	path := fmt.Sprintf("/projects/%s/hooks?url=%s&push_events=true&merge_requests_events=true", url.QueryEscape(fullname), url.QueryEscape(hook.URL))
+	return c.do(ctx, http.MethodPost, path, nil)
+}
+
+// DeleteHook removes a GitLab project webhook.
+func (c *Client) DeleteHook(ctx context.Context, fullname string, hook sdk.VCSHook) error {
+	path := fmt.Sprintf("/projects/%s/hooks/%s", url.QueryEscape(fullname), hook.ID)
+	return c.do(ctx, http.MethodDelete, path, nil)
+}
+
+// GetHook returns a previously registered GitLab project webhook.
+func (c *Client) GetHook(ctx context.Context, fullname, id string) (sdk.VCSHook, error) {
+	var h struct {
+		ID  int64  `json:"id"`
+		URL string `json:"url"`
+	}
+	path := fmt.Sprintf("/projects/%s/hooks/%s", url.QueryEscape(fullname), id)
+	if err := c.do(ctx, http.MethodGet, path, &h); err != nil {
+		return sdk.VCSHook{}, sdk.WrapError(err, "gitlab.GetHook> %s/%s", fullname, id)
+	}
+	return sdk.VCSHook{ID: strconv.FormatInt(h.ID, 10), URL: h.URL}, nil
+}
+
+// UpdateHook updates a GitLab project webhook's target URL.
+func (c *Client) UpdateHook(ctx context.Context, fullname string, hook *sdk.VCSHook) error {
+	path := fmt.Sprintf("/projects/%s/hooks/%s?url=%s&push_events=true&merge_requests_events=true", url.QueryEscape(fullname), hook.ID, url.QueryEscape(hook.URL))
+	return c.do(ctx, http.MethodPut, path, nil)
+}
+
+// RepoByFullname returns a single project by its namespaced path.
+func (c *Client) RepoByFullname(ctx context.Context, fullname string) (sdk.VCSRepo, error) {
+	var p struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		SSHURLToRepo      string `json:"ssh_url_to_repo"`
+		HTTPURLToRepo     string `json:"http_url_to_repo"`
+	}
+	path := fmt.Sprintf("/projects/%s", url.QueryEscape(fullname))
+	if err := c.do(ctx, http.MethodGet, path, &p); err != nil {
+		return sdk.VCSRepo{}, sdk.WrapError(err, "gitlab.RepoByFullname> %s", fullname)
+	}
+	return sdk.VCSRepo{
+		Fullname:     p.PathWithNamespace,
+		SSHCloneURL:  p.SSHURLToRepo,
+		HTTPCloneURL: p.HTTPURLToRepo,
+	}, nil
+}
+
+// Branches lists the branches of fullname.
+func (c *Client) Branches(ctx context.Context, fullname string) ([]sdk.VCSBranch, error) {
+	var branches []struct {
+		Name      string `json:"name"`
+		Default   bool   `json:"default"`
+		Commit    struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	path := fmt.Sprintf("/projects/%s/repository/branches", url.QueryEscape(fullname))
+	if err := c.do(ctx, http.MethodGet, path, &branches); err != nil {
+		return nil, sdk.WrapError(err, "gitlab.Branches> %s", fullname)
+	}
+
+	res := make([]sdk.VCSBranch, len(branches))
+	for i, b := range branches {
+		res[i] = sdk.VCSBranch{DisplayID: b.Name, Default: b.Default, LatestCommit: b.Commit.ID}
+	}
+	return res, nil
+}
+
+// Branch returns a single branch of fullname.
+func (c *Client) Branch(ctx context.Context, fullname, branchName string) (*sdk.VCSBranch, error) {
+	var b struct {
+		Name    string `json:"name"`
+		Default bool   `json:"default"`
+		Commit  struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	path := fmt.Sprintf("/projects/%s/repository/branches/%s", url.QueryEscape(fullname), url.PathEscape(branchName))
+	if err := c.do(ctx, http.MethodGet, path, &b); err != nil {
+		return nil, sdk.WrapError(err, "gitlab.Branch> %s/%s", fullname, branchName)
+	}
+	return &sdk.VCSBranch{DisplayID: b.Name, Default: b.Default, LatestCommit: b.Commit.ID}, nil
+}
+
+// Commits lists the commits of fullname on branch.
+func (c *Client) Commits(ctx context.Context, fullname, branch, since, until string) ([]sdk.VCSCommit, error) {
+	var commits []struct {
+		ID        string    `json:"id"`
+		Message   string    `json:"message"`
+		AuthorName string   `json:"author_name"`
+	}
+	path := fmt.Sprintf("/projects/%s/repository/commits?ref_name=%s", url.QueryEscape(fullname), url.QueryEscape(branch))
+	if since != "" {
+		path += "&since=" + url.QueryEscape(since)
+	}
+	if until != "" {
+		path += "&until=" + url.QueryEscape(until)
+	}
+	if err := c.do(ctx, http.MethodGet, path, &commits); err != nil {
+		return nil, sdk.WrapError(err, "gitlab.Commits> %s", fullname)
+	}
+
+	res := make([]sdk.VCSCommit, len(commits))
+	for i, cm := range commits {
+		res[i] = sdk.VCSCommit{Hash: cm.ID, Message: cm.Message, Author: sdk.VCSAuthor{Name: cm.AuthorName}}
+	}
+	return res, nil
+}
+
+// Commit returns a single commit of fullname by hash.
+func (c *Client) Commit(ctx context.Context, fullname, hash string) (sdk.VCSCommit, error) {
+	var cm struct {
+		ID         string `json:"id"`
+		Message    string `json:"message"`
+		AuthorName string `json:"author_name"`
+	}
+	path := fmt.Sprintf("/projects/%s/repository/commits/%s", url.QueryEscape(fullname), url.PathEscape(hash))
+	if err := c.do(ctx, http.MethodGet, path, &cm); err != nil {
+		return sdk.VCSCommit{}, sdk.WrapError(err, "gitlab.Commit> %s/%s", fullname, hash)
+	}
+	return sdk.VCSCommit{Hash: cm.ID, Message: cm.Message, Author: sdk.VCSAuthor{Name: cm.AuthorName}}, nil
+}
+
+// Tags lists the tags of fullname.
+func (c *Client) Tags(ctx context.Context, fullname string) ([]sdk.VCSTag, error) {
+	var tags []struct {
+		Name   string `json:"name"`
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	path := fmt.Sprintf("/projects/%s/repository/tags", url.QueryEscape(fullname))
+	if err := c.do(ctx, http.MethodGet, path, &tags); err != nil {
+		return nil, sdk.WrapError(err, "gitlab.Tags> %s", fullname)
+	}
+
+	res := make([]sdk.VCSTag, len(tags))
+	for i, t := range tags {
+		res[i] = sdk.VCSTag{Tag: t.Name, Hash: t.Commit.ID}
+	}
+	return res, nil
+}
+
+// PullRequestComment posts a comment on a GitLab merge request.
+func (c *Client) PullRequestComment(ctx context.Context, fullname string, id int, text string) error {
+	path := fmt.Sprintf("/projects/%s/merge_requests/%d/notes?body=%s", url.QueryEscape(fullname), id, url.QueryEscape(text))
+	return c.do(ctx, http.MethodPost, path, nil)
+}
@@ -0,0 +1,55 @@
+package vcs
+
+import (
+	"github.com/ovh/cds/engine/api/cache"
+	"github.com/ovh/cds/engine/vcs/bitbucket"
+	"github.com/ovh/cds/engine/vcs/gitea"
+	"github.com/ovh/cds/engine/vcs/github"
+	"github.com/ovh/cds/engine/vcs/gitlab"
+	"github.com/ovh/cds/sdk"
+)
+
+// ProviderFactory builds a sdk.VCSServer out of a VCS server configuration
+// entry and the service cache. It returns ok=false when none of its fields
+// in cfg are set, so getConsumer can try the next registered provider.
+type ProviderFactory func(cfg ServerConfiguration, store cache.Store) (srv sdk.VCSServer, ok bool, err error)
+
+var providers = map[string]ProviderFactory{}
+
+// RegisterProvider makes a VCS provider available to getConsumer under name,
+// without editing getConsumer itself. The built-in providers are registered
+// by this package's own init() func below; a package outside it can call
+// RegisterProvider from its own init() func once the binary imports it.
+func RegisterProvider(name string, factory ProviderFactory) {
+	providers[name] = factory
+}
+
+func init() {
+	RegisterProvider("github", func(cfg ServerConfiguration, store cache.Store) (sdk.VCSServer, bool, error) {
+		if cfg.Github == nil {
+			return nil, false, nil
+		}
+		return github.New(cfg.Github.ClientID, cfg.Github.ClientSecret, store), true, nil
+	})
+
+	RegisterProvider("gitlab", func(cfg ServerConfiguration, store cache.Store) (sdk.VCSServer, bool, error) {
+		if cfg.Gitlab == nil {
+			return nil, false, nil
+		}
+		return gitlab.New(cfg.Gitlab.URL, cfg.Gitlab.ClientID, cfg.Gitlab.ClientSecret, cfg.Gitlab.SSHFingerprint, store), true, nil
+	})
+
+	RegisterProvider("bitbucket", func(cfg ServerConfiguration, store cache.Store) (sdk.VCSServer, bool, error) {
+		if cfg.Bitbucket == nil {
+			return nil, false, nil
+		}
+		return bitbucket.New(cfg.Bitbucket.URL, cfg.Bitbucket.ClientID, cfg.Bitbucket.ClientSecret, cfg.Bitbucket.SSHFingerprint, store), true, nil
+	})
+
+	RegisterProvider("gitea", func(cfg ServerConfiguration, store cache.Store) (sdk.VCSServer, bool, error) {
+		if cfg.Gitea == nil {
+			return nil, false, nil
+		}
+		return gitea.New(cfg.Gitea.URL, cfg.Gitea.ClientID, cfg.Gitea.ClientSecret, cfg.Gitea.SSHFingerprint, store), true, nil
+	})
+}
@@ -0,0 +1,78 @@
+package vcs
+
+import (
+	"github.com/ovh/cds/engine/api"
+	"github.com/ovh/cds/engine/api/cache"
+	"github.com/ovh/cds/sdk/cdsclient"
+)
+
+// Service is the vcs µService
+type Service struct {
+	Router *api.Router
+	Cfg    Configuration
+	Cache  cache.Store
+	cds    cdsclient.Interface
+}
+
+// Configuration is the vcs service configuration structure
+type Configuration struct {
+	Name string `toml:"name" json:"name"`
+	URL  string `toml:"url" comment:"URL of this service" json:"url"`
+	HTTP struct {
+		Port int `toml:"port" default:"8080" json:"port"`
+	} `toml:"http" json:"http"`
+	API struct {
+		HTTP struct {
+			URL string `toml:"url" default:"http://localhost:8081" json:"url"`
+		} `toml:"http" json:"http"`
+	} `toml:"api" json:"api"`
+	Cache struct {
+		TTL   int `toml:"ttl" default:"60" json:"ttl"`
+		Redis struct {
+			Host     string `toml:"host" default:"localhost:6379" json:"host"`
+			Password string `toml:"password" json:"-"`
+		} `toml:"redis" json:"redis"`
+	} `toml:"cache" json:"cache"`
+	// Servers holds one configuration per named VCS server instance, e.g.
+	// "github", "my-gitlab". Exactly one provider sub-config should be set
+	// per entry; getConsumer dispatches on whichever one is populated.
+	Servers map[string]ServerConfiguration `toml:"servers" json:"servers"`
+}
+
+// ServerConfiguration is the configuration of one VCS server instance.
+type ServerConfiguration struct {
+	Github    *GithubServerConfiguration    `toml:"github" json:"github,omitempty"`
+	Gitlab    *GitlabServerConfiguration    `toml:"gitlab" json:"gitlab,omitempty"`
+	Bitbucket *BitbucketServerConfiguration `toml:"bitbucket" json:"bitbucket,omitempty"`
+	Gitea     *GiteaServerConfiguration     `toml:"gitea" json:"gitea,omitempty"`
+}
+
+// GithubServerConfiguration is the github.com specific part of a VCS server configuration.
+type GithubServerConfiguration struct {
+	ClientID     string `toml:"clientId" json:"client_id"`
+	ClientSecret string `toml:"clientSecret" json:"-"`
+}
+
+// GitlabServerConfiguration is the GitLab specific part of a VCS server configuration.
+type GitlabServerConfiguration struct {
+	URL            string `toml:"url" json:"url"`
+	ClientID       string `toml:"clientId" json:"client_id"`
+	ClientSecret   string `toml:"clientSecret" json:"-"`
+	SSHFingerprint string `toml:"sshFingerprint" json:"ssh_fingerprint"`
+}
+
+// BitbucketServerConfiguration is the Bitbucket Server specific part of a VCS server configuration.
+type BitbucketServerConfiguration struct {
+	URL            string `toml:"url" json:"url"`
+	ClientID       string `toml:"clientId" json:"client_id"`
+	ClientSecret   string `toml:"clientSecret" json:"-"`
+	SSHFingerprint string `toml:"sshFingerprint" json:"ssh_fingerprint"`
+}
+
+// GiteaServerConfiguration is the Gitea specific part of a VCS server configuration.
+type GiteaServerConfiguration struct {
+	URL            string `toml:"url" json:"url"`
+	ClientID       string `toml:"clientId" json:"client_id"`
+	ClientSecret   string `toml:"clientSecret" json:"-"`
+	SSHFingerprint string `toml:"sshFingerprint" json:"ssh_fingerprint"`
+}
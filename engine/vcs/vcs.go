@@ -10,7 +10,6 @@ import (
 
 	"github.com/ovh/cds/engine/api"
 	"github.com/ovh/cds/engine/api/cache"
-	"github.com/ovh/cds/engine/vcs/github"
 	"github.com/ovh/cds/sdk"
 	"github.com/ovh/cds/sdk/cdsclient"
 	"github.com/ovh/cds/sdk/hatchery"
@@ -50,14 +49,57 @@ func (s *Service) CheckConfiguration(config interface{}) error {
 		return fmt.Errorf("your CDS configuration seems to be empty. Please use environment variables, file or Consul to set your configuration")
 	}
 
+	for name, serverCfg := range sConfig.Servers {
+		if err := checkServerConfiguration(name, serverCfg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkServerConfiguration makes sure a configured VCS server has every
+// mandatory field set for whichever provider sub-config is populated.
+func checkServerConfiguration(name string, cfg ServerConfiguration) error {
+	switch {
+	case cfg.Github != nil:
+		if cfg.Github.ClientID == "" || cfg.Github.ClientSecret == "" {
+			return fmt.Errorf("vcs server %s: github clientId and clientSecret are mandatory", name)
+		}
+	case cfg.Gitlab != nil:
+		if cfg.Gitlab.URL == "" || cfg.Gitlab.ClientID == "" || cfg.Gitlab.ClientSecret == "" {
+			return fmt.Errorf("vcs server %s: gitlab url, clientId and clientSecret are mandatory", name)
+		}
+	case cfg.Bitbucket != nil:
+		if cfg.Bitbucket.URL == "" || cfg.Bitbucket.ClientID == "" || cfg.Bitbucket.ClientSecret == "" {
+			return fmt.Errorf("vcs server %s: bitbucket url, clientId and clientSecret are mandatory", name)
+		}
+	case cfg.Gitea != nil:
+		if cfg.Gitea.URL == "" || cfg.Gitea.ClientID == "" || cfg.Gitea.ClientSecret == "" {
+			return fmt.Errorf("vcs server %s: gitea url, clientId and clientSecret are mandatory", name)
+		}
+	default:
+		return fmt.Errorf("vcs server %s: no provider configured", name)
+	}
 	return nil
 }
 
 func (s *Service) getConsumer(name string) (sdk.VCSServer, error) {
-	serverCfg := s.Cfg.Servers[name]
-	if serverCfg.Github != nil {
-		return github.New(serverCfg.Github.ClientID, serverCfg.Github.ClientSecret, s.Cache), nil
+	serverCfg, ok := s.Cfg.Servers[name]
+	if !ok {
+		return nil, sdk.ErrNotFound
+	}
+
+	for _, factory := range providers {
+		srv, ok, err := factory(serverCfg, s.Cache)
+		if err != nil {
+			return nil, sdk.WrapError(err, "getConsumer> Unable to init VCS provider for %s", name)
+		}
+		if ok {
+			return srv, nil
+		}
 	}
+
 	return nil, sdk.ErrNotFound
 }
 